@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/killswitch"
+	"github.com/leodotcloud/chaos-monkey/probe"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
+)
+
+const (
+	// DefaultAbortMaxHostsNotActive ...
+	DefaultAbortMaxHostsNotActive = 3
+	// DefaultAbortMaxVerifyFailures ...
+	DefaultAbortMaxVerifyFailures = 3
+	// DefaultAbortVerifyFailureWindow ...
+	DefaultAbortVerifyFailureWindow = time.Hour
+	// DefaultAbortMaxDegraded ...
+	DefaultAbortMaxDegraded = 30 * time.Minute
+	// alertTimeout bounds the delivery of an alert
+	alertTimeout = 10 * time.Second
+)
+
+// AbortRules halt the injection of faults when the chaos monkey is
+// clearly hurting the environment. A zero value disables the rule.
+type AbortRules struct {
+	// MaxHostsNotActive is the number of cmhost hosts not active, nor
+	// being created, above which to abort
+	MaxHostsNotActive int
+	// MaxVerifyFailures is the number of failed verifications within
+	// VerifyFailureWindow at which to abort
+	MaxVerifyFailures   int
+	VerifyFailureWindow time.Duration
+	// MaxDegraded is how long the cmstack-long stack may stay degraded
+	// before aborting
+	MaxDegraded time.Duration
+	// AlertWebhook, if set, is sent a JSON alert when aborting
+	AlertWebhook string
+}
+
+// abortState is what the abort rules have observed so far
+type abortState struct {
+	verifyFailures []time.Time
+	degradedSince  time.Time
+}
+
+// SetAbortRules sets the rules halting the injection of faults
+func (cm *ChaosMonkey) SetAbortRules(rules AbortRules) {
+	cm.abortRules = rules
+}
+
+// noteExecution keeps track of the failed verifications
+func (cm *ChaosMonkey) noteExecution(ex *types.Execution) {
+	if p := ex.GetPhase(types.PhaseVerify); p != nil && p.Err != nil {
+		cm.abortState.verifyFailures = append(cm.abortState.verifyFailures, p.End)
+	}
+}
+
+// checkAbortRules returns an error describing the first abort rule which
+// fires
+func (cm *ChaosMonkey) checkAbortRules(ctx context.Context) error {
+	rules := cm.abortRules
+	state := &cm.abortState
+	si := cm.sharedInfo
+
+	stack := &probe.StackActive{Stack: "cmstack-long"}
+	var degradedErr error
+	if rules.MaxDegraded > 0 {
+		degradedErr = stack.Check(ctx, si)
+	}
+
+	if rules.MaxHostsNotActive > 0 {
+		// The hosts still being created, e.g. by the setup, aren't
+		// counted
+		failing, err := utils.GetFailingHosts(ctx, si)
+		if err != nil {
+			logrus.Errorf("error checking the hosts for abort: %v", err)
+		} else if len(failing) > rules.MaxHostsNotActive {
+			return fmt.Errorf("%v hosts are not active, more than the %v allowed",
+				len(failing), rules.MaxHostsNotActive)
+		}
+	}
+
+	// The state is shared with the recording of the
+	// executions, which may finish concurrently
+	cm.recordMu.Lock()
+	defer cm.recordMu.Unlock()
+
+	if rules.MaxVerifyFailures > 0 {
+		var recent []time.Time
+		for _, t := range state.verifyFailures {
+			if rules.VerifyFailureWindow <= 0 || time.Since(t) <= rules.VerifyFailureWindow {
+				recent = append(recent, t)
+			}
+		}
+		state.verifyFailures = recent
+		if len(recent) >= rules.MaxVerifyFailures {
+			return fmt.Errorf("%v verifications failed within %v",
+				len(recent), rules.VerifyFailureWindow)
+		}
+	}
+
+	if rules.MaxDegraded > 0 {
+		if degradedErr != nil {
+			if state.degradedSince.IsZero() {
+				state.degradedSince = time.Now()
+			}
+			if degraded := time.Since(state.degradedSince); degraded > rules.MaxDegraded {
+				return fmt.Errorf("%v degraded for %v: %v", stack.GetName(), degraded, degradedErr)
+			}
+		} else {
+			state.degradedSince = time.Time{}
+		}
+	}
+
+	return nil
+}
+
+// abort halts the injection of faults by engaging the kill switch, and
+// alerts about it. What was observed until now is forgotten, so that the
+// injection can be resumed by releasing the kill switch.
+func (cm *ChaosMonkey) abort(reason error) {
+	logrus.Errorf("aborting fault injection: %v", reason)
+	cm.recordMu.Lock()
+	cm.abortState = abortState{}
+	cm.recordMu.Unlock()
+	cm.killSwitch.Engage(killswitch.SourceAbort, reason.Error())
+	if cm.abortRules.AlertWebhook != "" {
+		if err := sendAlert(cm.abortRules.AlertWebhook, cm.sharedInfo.Campaign, reason); err != nil {
+			logrus.Errorf("error sending alert: %v", err)
+		}
+	}
+}
+
+// alert is the JSON body posted to the alert webhook
+type alert struct {
+	Time     time.Time `json:"time"`
+	Campaign string    `json:"campaign"`
+	Reason   string    `json:"reason"`
+}
+
+func sendAlert(webhook, campaign string, reason error) error {
+	body, err := json.Marshal(alert{
+		Time:     time.Now().UTC(),
+		Campaign: campaign,
+		Reason:   reason.Error(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c := &http.Client{Timeout: alertTimeout}
+	resp, err := c.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got status %v from %v", resp.Status, webhook)
+	}
+	return nil
+}
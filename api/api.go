@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/journal"
+)
+
+// defaultExecutions is the number of executions shown when not asked for
+// a specific number
+const defaultExecutions = 10
+
+// Errors returned by a Controller, which are mapped to HTTP statuses
+var (
+	ErrUnknownScenario = errors.New("unknown scenario")
+	ErrBusy            = errors.New("a triggered scenario is already pending")
+	ErrInvalidWait     = errors.New("min wait must be at least 0 and less than max wait")
+	ErrRateLimited     = errors.New("the maximum of scenarios an hour was reached")
+)
+
+// PausedError is returned by a Controller while the injection of faults
+// is paused, naming the sources pausing it
+type PausedError struct {
+	Sources []string
+}
+
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("fault injection is paused by %v", strings.Join(e.Sources, ", "))
+}
+
+// Scenario describes a registered scenario
+type Scenario struct {
+	ID            string            `json:"id"`
+	Description   string            `json:"description"`
+	Tags          []string          `json:"tags"`
+	Enabled       bool              `json:"enabled"`
+	Weight        int               `json:"weight"`
+	VerifyTimeout string            `json:"verifyTimeout"`
+	Cooldown      string            `json:"cooldown,omitempty"`
+	MaxPerHour    int               `json:"maxPerHour,omitempty"`
+	Params        map[string]string `json:"params,omitempty"`
+}
+
+// Wait is the range of the random interval between scenarios, in seconds
+type Wait struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Current describes a scenario in flight
+type Current struct {
+	Scenario string    `json:"scenario"`
+	Start    time.Time `json:"start"`
+}
+
+// Affected counts the resources affected by the scenarios in flight
+type Affected struct {
+	Hosts     int `json:"hosts"`
+	Services  int `json:"services"`
+	Instances int `json:"instances"`
+}
+
+// Status describes the state of the chaos monkey
+type Status struct {
+	Campaign     string            `json:"campaign"`
+	Paused       bool              `json:"paused"`
+	PauseReasons map[string]string `json:"pauseReasons,omitempty"`
+	Wait         Wait              `json:"wait"`
+	// Current is the last scenario started of the ones in flight
+	Current  *Current  `json:"current,omitempty"`
+	Running  []Current `json:"running,omitempty"`
+	Affected Affected  `json:"affected"`
+}
+
+// Controller is what the API controls
+type Controller interface {
+	Status() Status
+	// Pause stops the injection of faults, interrupting the scenarios in
+	// flight
+	Pause(reason string)
+	// Resume releases every pause, except the kill switch file which
+	// only its removal releases, and returns a *PausedError if the
+	// injection stays paused
+	Resume() error
+	Scenarios() []Scenario
+	// Trigger runs the scenario next, instead of a random one. It
+	// returns a *PausedError while paused, and ErrRateLimited once the
+	// maximum of scenarios an hour is reached.
+	Trigger(id string) error
+	// Executions returns the last n finished executions, oldest first
+	Executions(n int) []journal.Record
+	SetWait(w Wait) error
+}
+
+// Handler serves the API of the controller:
+//
+//	GET  /status
+//	POST /pause?reason=...
+//	POST /resume
+//	GET  /scenarios
+//	POST /scenarios/<id>/trigger
+//	GET  /executions?n=10
+//	GET  /wait
+//	PUT  /wait {"min": 60, "max": 300}
+//
+// Resuming also releases the kill switch and an abort, but not the kill
+// switch file. Resuming while the file exists, and triggering while
+// paused, fail with 409 naming what pauses the injection.
+type Handler struct {
+	c   Controller
+	mux *http.ServeMux
+}
+
+// NewHandler returns the handler serving the API of the controller
+func NewHandler(c Controller) *Handler {
+	h := &Handler{
+		c:   c,
+		mux: http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/status", h.status)
+	h.mux.HandleFunc("/pause", h.pause)
+	h.mux.HandleFunc("/resume", h.resume)
+	h.mux.HandleFunc("/scenarios", h.scenarios)
+	h.mux.HandleFunc("/scenarios/", h.trigger)
+	h.mux.HandleFunc("/executions", h.executions)
+	h.mux.HandleFunc("/wait", h.wait)
+	return h
+}
+
+// ServeHTTP ...
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	respond(w, h.c.Status())
+}
+
+func (h *Handler) pause(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "POST") {
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "paused from " + r.RemoteAddr
+	}
+	h.c.Pause(reason)
+	respond(w, h.c.Status())
+}
+
+func (h *Handler) resume(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "POST") {
+		return
+	}
+	if err := h.c.Resume(); err != nil {
+		fail(w, err)
+		return
+	}
+	respond(w, h.c.Status())
+}
+
+func (h *Handler) scenarios(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	respond(w, h.c.Scenarios())
+}
+
+func (h *Handler) trigger(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/scenarios/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "trigger" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allow(w, r, "POST") {
+		return
+	}
+	if err := h.c.Trigger(parts[0]); err != nil {
+		fail(w, err)
+		return
+	}
+	respondWithCode(w, http.StatusAccepted, h.c.Status())
+}
+
+func (h *Handler) executions(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	n := defaultExecutions
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid n: %v", s), http.StatusBadRequest)
+			return
+		}
+	}
+	respond(w, h.c.Executions(n))
+}
+
+func (h *Handler) wait(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET", "PUT") {
+		return
+	}
+	if r.Method == "PUT" {
+		var wait Wait
+		if err := json.NewDecoder(r.Body).Decode(&wait); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := h.c.SetWait(wait); err != nil {
+			fail(w, err)
+			return
+		}
+	}
+	respond(w, h.c.Status().Wait)
+}
+
+// allow responds with 405 and returns false unless the request uses one
+// of the methods
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// fail responds with the HTTP status matching the error of the controller
+func fail(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if _, ok := err.(*PausedError); ok {
+		code = http.StatusConflict
+	}
+	switch err {
+	case ErrUnknownScenario:
+		code = http.StatusNotFound
+	case ErrBusy:
+		code = http.StatusConflict
+	case ErrInvalidWait:
+		code = http.StatusBadRequest
+	case ErrRateLimited:
+		code = http.StatusTooManyRequests
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func respond(w http.ResponseWriter, v interface{}) {
+	respondWithCode(w, http.StatusOK, v)
+}
+
+func respondWithCode(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("error writing API response: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leodotcloud/chaos-monkey/journal"
+)
+
+// controller is a Controller recording what it is asked
+type controller struct {
+	status     Status
+	triggerErr error
+	resumeErr  error
+	triggered  string
+	resumed    bool
+	executions int
+}
+
+func (c *controller) Status() Status { return c.status }
+
+func (c *controller) Pause(reason string) {
+	c.status.Paused = true
+	c.status.PauseReasons = map[string]string{"api": reason}
+}
+
+func (c *controller) Resume() error {
+	c.resumed = true
+	if c.resumeErr != nil {
+		return c.resumeErr
+	}
+	c.status.Paused = false
+	c.status.PauseReasons = nil
+	return nil
+}
+
+func (c *controller) Scenarios() []Scenario {
+	return []Scenario{{ID: "add-host-api", Enabled: true, Weight: 1}}
+}
+
+func (c *controller) Trigger(id string) error {
+	if c.triggerErr != nil {
+		return c.triggerErr
+	}
+	if id != "add-host-api" {
+		return ErrUnknownScenario
+	}
+	c.triggered = id
+	return nil
+}
+
+func (c *controller) Executions(n int) []journal.Record {
+	c.executions = n
+	return []journal.Record{}
+}
+
+func (c *controller) SetWait(w Wait) error {
+	if w.Min < 0 || w.Min >= w.Max {
+		return ErrInvalidWait
+	}
+	c.status.Wait = w
+	return nil
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	paused := &PausedError{Sources: []string{"file"}}
+
+	tests := []struct {
+		name       string
+		controller *controller
+		method     string
+		path       string
+		body       string
+		code       int
+		contains   string
+	}{
+		{name: "status", method: "GET", path: "/status", code: http.StatusOK, contains: `"paused":false`},
+		{name: "status method", method: "POST", path: "/status", code: http.StatusMethodNotAllowed},
+		{name: "pause", method: "POST", path: "/pause?reason=deploy", code: http.StatusOK, contains: `"api":"deploy"`},
+		{name: "resume", method: "POST", path: "/resume", code: http.StatusOK},
+		{
+			name:       "resume while paused by the file",
+			controller: &controller{resumeErr: paused},
+			method:     "POST", path: "/resume", code: http.StatusConflict, contains: "paused by file",
+		},
+		{name: "scenarios", method: "GET", path: "/scenarios", code: http.StatusOK, contains: `"id":"add-host-api"`},
+		{name: "trigger", method: "POST", path: "/scenarios/add-host-api/trigger", code: http.StatusAccepted},
+		{name: "trigger unknown", method: "POST", path: "/scenarios/nope/trigger", code: http.StatusNotFound},
+		{name: "trigger method", method: "GET", path: "/scenarios/add-host-api/trigger", code: http.StatusMethodNotAllowed},
+		{name: "trigger path", method: "POST", path: "/scenarios/add-host-api/run", code: http.StatusNotFound},
+		{
+			name:       "trigger while paused",
+			controller: &controller{triggerErr: paused},
+			method:     "POST", path: "/scenarios/add-host-api/trigger", code: http.StatusConflict, contains: "paused by file",
+		},
+		{
+			name:       "trigger while busy",
+			controller: &controller{triggerErr: ErrBusy},
+			method:     "POST", path: "/scenarios/add-host-api/trigger", code: http.StatusConflict,
+		},
+		{
+			name:       "trigger rate limited",
+			controller: &controller{triggerErr: ErrRateLimited},
+			method:     "POST", path: "/scenarios/add-host-api/trigger", code: http.StatusTooManyRequests,
+		},
+		{name: "executions", method: "GET", path: "/executions?n=3", code: http.StatusOK},
+		{name: "executions invalid", method: "GET", path: "/executions?n=-1", code: http.StatusBadRequest},
+		{name: "wait", method: "GET", path: "/wait", code: http.StatusOK, contains: `"min":0`},
+		{name: "set wait", method: "PUT", path: "/wait", body: `{"min": 60, "max": 300}`, code: http.StatusOK, contains: `"max":300`},
+		{name: "set invalid wait", method: "PUT", path: "/wait", body: `{"min": 300, "max": 60}`, code: http.StatusBadRequest},
+		{name: "set wait body", method: "PUT", path: "/wait", body: `{`, code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		c := test.controller
+		if c == nil {
+			c = &controller{}
+		}
+		w := serve(NewHandler(c), test.method, test.path, test.body)
+		if w.Code != test.code {
+			t.Errorf("%v: %v %v returned %v, expecting %v: %v", test.name, test.method, test.path, w.Code, test.code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.contains) {
+			t.Errorf("%v: %v %v returned %v, expecting %v", test.name, test.method, test.path, w.Body, test.contains)
+		}
+	}
+}
+
+func TestHandlerCallsController(t *testing.T) {
+	c := &controller{}
+	h := NewHandler(c)
+
+	serve(h, "POST", "/pause", "")
+	if !c.status.Paused || !strings.HasPrefix(c.status.PauseReasons["api"], "paused from ") {
+		t.Errorf("pausing without a reason gave %+v", c.status)
+	}
+
+	serve(h, "POST", "/resume", "")
+	if !c.resumed || c.status.Paused {
+		t.Errorf("resuming didn't resume: %+v", c.status)
+	}
+
+	w := serve(h, "POST", "/scenarios/add-host-api/trigger", "")
+	if c.triggered != "add-host-api" {
+		t.Errorf("triggered %q, expecting add-host-api", c.triggered)
+	}
+	var status Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Errorf("triggering returned an invalid status: %v", err)
+	}
+
+	serve(h, "GET", "/executions", "")
+	if c.executions != defaultExecutions {
+		t.Errorf("asked for %v executions, expecting %v", c.executions, defaultExecutions)
+	}
+	serve(h, "GET", "/executions?n=3", "")
+	if c.executions != 3 {
+		t.Errorf("asked for %v executions, expecting 3", c.executions)
+	}
+
+	serve(h, "PUT", "/wait", `{"min": 10, "max": 20}`)
+	if c.status.Wait != (Wait{Min: 10, Max: 20}) {
+		t.Errorf("wait is %+v, expecting 10 to 20", c.status.Wait)
+	}
+}
+
+func TestPausedError(t *testing.T) {
+	err := &PausedError{Sources: []string{"abort", "file"}}
+	if got := err.Error(); got != "fault injection is paused by abort, file" {
+		t.Errorf("Error() = %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+package blast
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Budget limits the resources affected at once by the faults in flight.
+// Zero values are unlimited.
+type Budget struct {
+	Hosts     int
+	Services  int
+	Instances int
+}
+
+// IsZero returns true if the budget is unlimited
+func (b Budget) IsZero() bool {
+	return b == Budget{}
+}
+
+// Target is a resource affected by a fault: a host, or an instance along
+// with the host it runs on and the service it belongs to
+type Target struct {
+	Host     string
+	Service  string
+	Instance string
+}
+
+func (t Target) String() string {
+	if t.Instance != "" {
+		return "instance " + t.Instance
+	}
+	return "host " + t.Host
+}
+
+// overlaps returns why the targets can't be affected at once, if they
+// can't. Faults overlap when they hit the same instance or service, or
+// when a host is hit along with anything running on it.
+func (t Target) overlaps(other Target) (bool, string) {
+	switch {
+	case t.Instance != "" && t.Instance == other.Instance:
+		return true, "same instance"
+	case t.Service != "" && t.Service == other.Service:
+		return true, "same service " + t.Service
+	case t.Host != "" && t.Host == other.Host && (t.Instance == "" || other.Instance == ""):
+		return true, "same host " + t.Host
+	}
+	return false, ""
+}
+
+// Radius keeps track of the targets of the faults in flight, by the
+// owner injecting them, and keeps them within the budget and apart from
+// each other. A nil Radius allows everything.
+type Radius struct {
+	mu     sync.Mutex
+	budget Budget
+	claims map[interface{}][]Target
+}
+
+// New returns a Radius enforcing the budget
+func New(budget Budget) *Radius {
+	return &Radius{
+		budget: budget,
+		claims: map[interface{}][]Target{},
+	}
+}
+
+// count returns the number of distinct hosts, services and instances
+// claimed, along with the extra targets
+func (r *Radius) count(extra ...Target) Budget {
+	hosts := map[string]bool{}
+	services := map[string]bool{}
+	instances := map[string]bool{}
+	add := func(t Target) {
+		if t.Instance == "" {
+			hosts[t.Host] = true
+		} else {
+			instances[t.Instance] = true
+		}
+		if t.Service != "" {
+			services[t.Service] = true
+		}
+	}
+	for _, targets := range r.claims {
+		for _, t := range targets {
+			add(t)
+		}
+	}
+	for _, t := range extra {
+		add(t)
+	}
+	return Budget{
+		Hosts:     len(hosts),
+		Services:  len(services),
+		Instances: len(instances),
+	}
+}
+
+func (r *Radius) check(owner interface{}, t Target) error {
+	for o, targets := range r.claims {
+		if o == owner {
+			continue
+		}
+		for _, claimed := range targets {
+			if ok, reason := t.overlaps(claimed); ok {
+				return fmt.Errorf("%v overlaps %v affected by another fault: %v", t, claimed, reason)
+			}
+		}
+	}
+
+	affected := r.count(t)
+	switch {
+	case r.budget.Hosts > 0 && affected.Hosts > r.budget.Hosts:
+		return fmt.Errorf("%v would exceed the budget of %v affected hosts", t, r.budget.Hosts)
+	case r.budget.Services > 0 && affected.Services > r.budget.Services:
+		return fmt.Errorf("%v would exceed the budget of %v affected services", t, r.budget.Services)
+	case r.budget.Instances > 0 && affected.Instances > r.budget.Instances:
+		return fmt.Errorf("%v would exceed the budget of %v affected instances", t, r.budget.Instances)
+	}
+	return nil
+}
+
+// Check returns an error if the owner can't affect the target, because
+// it overlaps the target of another owner or exceeds the budget
+func (r *Radius) Check(owner interface{}, t Target) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.check(owner, t)
+}
+
+// Claim records that the owner affects the target, unless Check fails
+func (r *Radius) Claim(owner interface{}, t Target) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.check(owner, t); err != nil {
+		return err
+	}
+	r.claims[owner] = append(r.claims[owner], t)
+	return nil
+}
+
+// Release forgets the targets of the owner, once its fault is over
+func (r *Radius) Release(owner interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.claims, owner)
+}
+
+// ClaimedHosts returns the hosts affected as a whole by the faults in
+// flight, as opposed to the hosts of the instances affected
+func (r *Radius) ClaimedHosts() map[string]bool {
+	hosts := map[string]bool{}
+	if r == nil {
+		return hosts
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, targets := range r.claims {
+		for _, t := range targets {
+			if t.Instance == "" {
+				hosts[t.Host] = true
+			}
+		}
+	}
+	return hosts
+}
+
+// Affected returns the number of hosts, services and instances affected
+// by the faults in flight
+func (r *Radius) Affected() Budget {
+	if r == nil {
+		return Budget{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count()
+}
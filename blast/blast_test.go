@@ -0,0 +1,101 @@
+package blast
+
+import "testing"
+
+func TestClaimOverlaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		claimed Target
+		target  Target
+		overlap bool
+	}{
+		{"same instance", Target{Host: "h1", Instance: "i1"}, Target{Host: "h2", Instance: "i1"}, true},
+		{"same service", Target{Host: "h1", Service: "s1", Instance: "i1"}, Target{Host: "h2", Service: "s1", Instance: "i2"}, true},
+		{"host of the instance", Target{Host: "h1"}, Target{Host: "h1", Instance: "i1"}, true},
+		{"instance on the host", Target{Host: "h1", Instance: "i1"}, Target{Host: "h1"}, true},
+		{"instances of the same host", Target{Host: "h1", Instance: "i1"}, Target{Host: "h1", Instance: "i2"}, false},
+		{"other host", Target{Host: "h1"}, Target{Host: "h2"}, false},
+	}
+
+	for _, test := range tests {
+		r := New(Budget{})
+		if err := r.Claim("a", test.claimed); err != nil {
+			t.Fatalf("%v: claiming %v failed: %v", test.name, test.claimed, err)
+		}
+		// An owner never overlaps itself
+		if err := r.Check("a", test.target); err != nil {
+			t.Errorf("%v: checking %v for its own owner failed: %v", test.name, test.target, err)
+		}
+		err := r.Claim("b", test.target)
+		if (err != nil) != test.overlap {
+			t.Errorf("%v: claiming %v gave %v, expecting an overlap: %v", test.name, test.target, err, test.overlap)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		claims []Target
+		target Target
+		fits   bool
+	}{
+		{"hosts", Budget{Hosts: 1}, []Target{{Host: "h1"}}, Target{Host: "h2"}, false},
+		{"services", Budget{Services: 1}, []Target{{Host: "h1", Service: "s1", Instance: "i1"}}, Target{Host: "h2", Service: "s2", Instance: "i2"}, false},
+		{"instances", Budget{Instances: 2}, []Target{{Host: "h1", Instance: "i1"}}, Target{Host: "h2", Instance: "i2"}, true},
+		{"instances exceeded", Budget{Instances: 1}, []Target{{Host: "h1", Instance: "i1"}}, Target{Host: "h2", Instance: "i2"}, false},
+		{"unlimited", Budget{}, []Target{{Host: "h1"}, {Host: "h2"}}, Target{Host: "h3"}, true},
+	}
+
+	for _, test := range tests {
+		r := New(test.budget)
+		for i, claim := range test.claims {
+			if err := r.Claim(i, claim); err != nil {
+				t.Fatalf("%v: claiming %v failed: %v", test.name, claim, err)
+			}
+		}
+		err := r.Check("new", test.target)
+		if (err == nil) != test.fits {
+			t.Errorf("%v: checking %v gave %v, expecting it to fit: %v", test.name, test.target, err, test.fits)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	r := New(Budget{Hosts: 1})
+	if err := r.Claim("a", Target{Host: "h1"}); err != nil {
+		t.Fatalf("claiming failed: %v", err)
+	}
+	if err := r.Claim("a", Target{Host: "h1", Service: "s1", Instance: "i1"}); err != nil {
+		t.Fatalf("claiming failed: %v", err)
+	}
+	if got := r.Affected(); got != (Budget{Hosts: 1, Services: 1, Instances: 1}) {
+		t.Errorf("Affected = %+v", got)
+	}
+	if got := r.ClaimedHosts(); len(got) != 1 || !got["h1"] {
+		t.Errorf("ClaimedHosts = %v, expecting h1", got)
+	}
+
+	r.Release("a")
+	if got := r.Affected(); !got.IsZero() {
+		t.Errorf("Affected after release = %+v", got)
+	}
+	if err := r.Claim("b", Target{Host: "h2"}); err != nil {
+		t.Errorf("claiming after release failed: %v", err)
+	}
+}
+
+func TestNilRadius(t *testing.T) {
+	var r *Radius
+	if err := r.Claim("a", Target{Host: "h1"}); err != nil {
+		t.Errorf("a nil radius refused a claim: %v", err)
+	}
+	r.Release("a")
+	if got := r.ClaimedHosts(); len(got) != 0 {
+		t.Errorf("ClaimedHosts of a nil radius = %v", got)
+	}
+	if got := r.Affected(); !got.IsZero() {
+		t.Errorf("Affected of a nil radius = %+v", got)
+	}
+}
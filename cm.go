@@ -1,10 +1,19 @@
 package main
 
 import (
-	"math/rand"
+	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/blast"
+	"github.com/leodotcloud/chaos-monkey/cooldown"
+	"github.com/leodotcloud/chaos-monkey/docker"
+	"github.com/leodotcloud/chaos-monkey/journal"
+	"github.com/leodotcloud/chaos-monkey/killswitch"
+	"github.com/leodotcloud/chaos-monkey/probe"
+	"github.com/leodotcloud/chaos-monkey/random"
 	"github.com/leodotcloud/chaos-monkey/scenarios"
 	"github.com/leodotcloud/chaos-monkey/types"
 	"github.com/leodotcloud/chaos-monkey/utils"
@@ -24,6 +33,10 @@ const (
 	DefaultMaximumClusterSize = 15
 )
 
+// anyScenario is the key under which the starts of all the scenarios are
+// rate limited
+const anyScenario = "*"
+
 func test() {
 	logrus.Infof("hello")
 }
@@ -37,12 +50,35 @@ type ChaosMonkey struct {
 	minWait         int
 	maxWait         int
 	seed            int64
+	duration        time.Duration
+	iterations      int
+	scenarioFilter  scenarios.Filter
 	sharedInfo      *types.SharedInfo
+	summary         summary
+	journal         *journal.Journal
+	probes          []probe.Probe
+	killSwitch      *killswitch.Switch
+	abortRules      AbortRules
+	abortState      abortState
+	triggers        chan types.Scenario
+	maxConcurrent   int
+	maxPerHour      int
+	cooldowns       *cooldown.Tracker
+
+	// recordMu serializes the recording of the executions, which may
+	// finish concurrently, and guards the summary and the abort state
+	recordMu sync.Mutex
+
+	// mu guards the fields below, which are shared with the API
+	mu      sync.Mutex
+	running []*types.Execution
+	history []journal.Record
 }
 
 // NewChaosMonkey returns a new instance of ChaosMonkey
-func NewChaosMonkey(url, cattleProjectID, cattleAccessKey, cattleSecretKey string,
-	minWait, maxWait int, seed int64,
+func NewChaosMonkey(ctx context.Context, url, cattleProjectID, cattleAccessKey, cattleSecretKey string,
+	minWait, maxWait int, seed int64, duration time.Duration, iterations int,
+	scenarioFilter scenarios.Filter,
 	sharedInfo *types.SharedInfo) (*ChaosMonkey, error) {
 	// TODO: check if valid URL
 	// TODO: check if access key/secret key are working
@@ -52,32 +88,49 @@ func NewChaosMonkey(url, cattleProjectID, cattleAccessKey, cattleSecretKey strin
 		return nil, err
 	}
 
-	rawClient, err := utils.GetRawClient(parsedURL, cattleAccessKey, cattleSecretKey)
+	rawClient, err := utils.GetRawClient(ctx, parsedURL, cattleAccessKey, cattleSecretKey)
 	if err != nil {
 		return nil, err
 	}
+	sharedInfo.RawClient = rawClient
+	// The campaign resumed from a journal is kept, as it marks the
+	// resources created
+	if sharedInfo.Campaign == "" {
+		sharedInfo.Campaign = journal.NewCampaignID()
+	}
 
 	// TODO: if using same setup, check if current environment has allowSystemRole.
 	// If already given a projectID, then ignore
 	if cattleProjectID == "" {
-		cattleProjectID, err = utils.GetChaosMonkeyProjectID(rawClient)
+		cattleProjectID, err = utils.GetChaosMonkeyProjectID(ctx, sharedInfo)
 		if err != nil {
 			return nil, err
 		}
 	}
 	logrus.Infof("using project id: %v", cattleProjectID)
 
-	client, err := utils.GetClientForProject(parsedURL, cattleProjectID, cattleAccessKey, cattleSecretKey)
-	if err != nil {
-		return nil, err
+	if sharedInfo.DryRun && cattleProjectID == utils.DryRunProjectID {
+		// The project would only be created by a real run, so there is
+		// nothing to connect to
+		logrus.Infof("[dry-run] no chaosmonkey project exists, the cluster setup and the scenarios would act on an empty project")
+	} else {
+		client, err := utils.GetClientForProject(ctx, parsedURL, cattleProjectID, cattleAccessKey, cattleSecretKey)
+		if err != nil {
+			return nil, err
+		}
+		sharedInfo.Client = client
+		sharedInfo.Docker = docker.NewProxyExecutor(client)
+		if err := utils.AdoptLegacyResources(ctx, sharedInfo); err != nil {
+			return nil, err
+		}
 	}
-	sharedInfo.Client = client
 	// TODO: If no cloud provider is specified, disable other options dependent on that.
 
 	if seed == 0 {
 		seed = time.Now().UTC().UnixNano()
 	}
 	logrus.Infof("Using seed: %v", seed)
+	sharedInfo.Random = random.New(seed)
 
 	// TODO: Check which are actually needed
 	return &ChaosMonkey{
@@ -88,49 +141,326 @@ func NewChaosMonkey(url, cattleProjectID, cattleAccessKey, cattleSecretKey strin
 		minWait:         minWait,
 		maxWait:         maxWait,
 		seed:            seed,
+		duration:        duration,
+		iterations:      iterations,
+		scenarioFilter:  scenarioFilter,
 		sharedInfo:      sharedInfo,
+		killSwitch:      killswitch.New(),
+		triggers:        make(chan types.Scenario, 1),
+		maxConcurrent:   1,
+		cooldowns:       cooldown.New(),
 	}, nil
 }
 
-// Run starts the chaos tests against the provided URL
-func (cm *ChaosMonkey) Run() error {
+// Replay makes the run repeat the scenario and target choices recorded
+// in the given decision journal
+func (cm *ChaosMonkey) Replay(r io.Reader) error {
+	seed, err := cm.sharedInfo.Random.LoadReplay(r)
+	if err != nil {
+		return err
+	}
+	if seed != 0 {
+		logrus.Infof("Replaying with seed: %v", seed)
+		cm.seed = seed
+	}
+	return nil
+}
+
+// JournalDecisions makes the run write every random decision it makes
+// to w, so that the run can be replayed later
+func (cm *ChaosMonkey) JournalDecisions(w io.Writer) error {
+	return cm.sharedInfo.Random.SetJournal(w, cm.seed)
+}
+
+// SetJournal makes the run journal every scenario execution. If the
+// journal has records of a previous run, its campaign is resumed, along
+// with the rate limits, which must be set beforehand.
+func (cm *ChaosMonkey) SetJournal(j *journal.Journal) {
+	cm.journal = j
+	cm.sharedInfo.Campaign = j.Campaign()
+	for _, r := range j.Loaded() {
+		if r.Kind != journal.KindExecution {
+			utils.RestoreTargetCooldowns(cm.sharedInfo, r.Actions)
+		}
+		if r.Kind != journal.KindAction && r.Scenario != setupExecution && r.Scenario != teardownExecution {
+			cm.cooldowns.Hit(anyScenario, r.Start)
+			cm.cooldowns.Hit(r.Scenario, r.Start)
+		}
+	}
+	if n := j.Executions(); n > 0 {
+		logrus.Infof("Resuming campaign %v after %v executions, hosts created so far, removed by teardown --journal: %v",
+			j.Campaign(), n, j.CreatedHosts())
+	} else {
+		logrus.Infof("Starting campaign %v", j.Campaign())
+	}
+}
+
+// KillSwitch returns the switch pausing the injection of faults
+func (cm *ChaosMonkey) KillSwitch() *killswitch.Switch {
+	return cm.killSwitch
+}
+
+// SetProbes sets the probes defining the steady state of the system,
+// which is checked before and after every scenario
+func (cm *ChaosMonkey) SetProbes(probes []probe.Probe) {
+	cm.probes = probes
+	for _, p := range probes {
+		logrus.Infof("Steady state probe: %v", p.GetName())
+	}
+}
+
+// SetConcurrency lets up to max scenarios run at once, affecting no more
+// resources than the budget allows
+func (cm *ChaosMonkey) SetConcurrency(max int, budget blast.Budget) {
+	if max < 1 {
+		max = 1
+	}
+	cm.maxConcurrent = max
+	if max > 1 || !budget.IsZero() {
+		cm.sharedInfo.BlastRadius = blast.New(budget)
+		logrus.Infof("running up to %v scenarios at once, affecting at most %+v (0 is unlimited)", max, budget)
+	}
+}
+
+// SetRateLimits starts at most maxPerHour scenarios an hour, and doesn't
+// hit an instance or a host again within targetCooldown. Zero values
+// disable the limits.
+func (cm *ChaosMonkey) SetRateLimits(maxPerHour int, targetCooldown time.Duration) {
+	cm.maxPerHour = maxPerHour
+	if targetCooldown > 0 {
+		cm.sharedInfo.TargetCooldown = targetCooldown
+		cm.sharedInfo.RecentTargets = cooldown.New()
+	}
+}
+
+// newExecution returns a new execution of the scenario, whose actions are
+// journaled as they are taken
+func (cm *ChaosMonkey) newExecution(scenario string) *types.Execution {
+	ex := types.NewExecution(scenario)
+	if cm.journal != nil {
+		cm.journal.Follow(ex)
+	}
+	return ex
+}
+
+// record logs, counts and journals the execution
+func (cm *ChaosMonkey) record(ex *types.Execution) {
+	cm.recordMu.Lock()
+	defer cm.recordMu.Unlock()
+	logExecution(ex)
+	cm.addHistory(ex)
+	if ex.Scenario != setupExecution {
+		cm.summary.add(ex)
+		cm.noteExecution(ex)
+	}
+	if cm.journal != nil {
+		if err := cm.journal.Write(ex); err != nil {
+			logrus.Errorf("error journaling execution of %v: %v", ex.Scenario, err)
+		}
+	}
+}
+
+// Run starts the chaos tests against the provided URL. It returns once
+// the context is cancelled, after rolling back the scenarios in flight and
+// closing the docker proxies. If a duration or a number of iterations is
+// set, no new scenario is started once either of them is reached. No
+// scenario is started either while the kill switch is engaged, which the
+// abort rules do, and engaging it interrupts the scenarios in flight.
+// Unless concurrency is set, a scenario is only started once the previous
+// one is over.
+func (cm *ChaosMonkey) Run(ctx context.Context) error {
 	logrus.Infof("Running ChaosMonkey")
-	rand.Seed(cm.seed)
 
-	if err := cm.Setup(); err != nil {
-		logrus.Errorf("error setting up: %v", err)
-		return err
+	defer cm.summary.log()
+	defer utils.CloseDockerProxies(cm.sharedInfo)
+
+	if cm.noProject() {
+		logrus.Infof("[dry-run] no project to set up and run the scenarios in")
+		return nil
+	}
+
+	if err := cm.Setup(ctx); err != nil {
+		logrus.Errorf("error setting up cluster: %v", err)
 	}
 
 	// Initialize the scenarios
-	scenarios := scenarios.GetScenarios()
+	scenarios, err := scenarios.GetScenarios(cm.scenarioFilter)
+	if err != nil {
+		logrus.Errorf("error collecting scenarios: %v", err)
+		return err
+	}
+
+	// loopCtx bounds the waiting between and the starting of scenarios,
+	// the scenarios in flight are always allowed to finish
+	loopCtx := ctx
+	if cm.duration > 0 {
+		var cancel context.CancelFunc
+		loopCtx, cancel = context.WithTimeout(ctx, cm.duration)
+		defer cancel()
+	}
+
+	// A slot is taken by every scenario in flight
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, cm.maxConcurrent)
 
-	for {
-		randomPick := rand.Intn(len(scenarios))
-		randomScenario := scenarios[randomPick]
+	minWait, maxWait := cm.getWait()
+	backoff := minWait
+	started := 0
+	var triggered types.Scenario
+	for loopCtx.Err() == nil {
+		if cm.iterations > 0 && started >= cm.iterations {
+			logrus.Infof("completed %v iterations", cm.iterations)
+			break
+		}
 
-		if randomScenario.IsSkip() {
-			logrus.Debugf("Skip scenario: %v", randomScenario.GetName())
+		select {
+		case slots <- struct{}{}:
+		case <-loopCtx.Done():
 			continue
 		}
 
-		logrus.Infof("Triggering scenario: %v", randomScenario.GetName())
-		if err := randomScenario.Run(cm.sharedInfo); err != nil {
-			logrus.Infof("Error running scenario %v: %v", randomScenario.GetName(), err)
+		if err := cm.checkAbortRules(loopCtx); err != nil {
+			cm.abort(err)
+		}
+		if cm.killSwitch.Engaged() {
+			<-slots
+			logrus.Warnf("fault injection paused by the kill switch: %v", cm.killSwitch)
+			cm.killSwitch.WaitReleased(loopCtx)
+			continue
+		}
+
+		minWait, maxWait = cm.getWait()
+		randomScenario := triggered
+		triggered = nil
+		// The triggered scenarios count toward the limit as well
+		ready, limitReason := cm.cooldowns.Ready(anyScenario, time.Now(), 0, cm.maxPerHour)
+		if randomScenario != nil && !ready {
+			logrus.Warnf("not running triggered scenario %v: %v", randomScenario.GetID(), limitReason)
+			randomScenario = nil
+		}
+		if randomScenario == nil {
+			var reasons []string
+			if ready {
+				randomScenario, reasons = pickScenario(scenarios, cm.sharedInfo, cm.cooldowns)
+			} else {
+				reasons = append(reasons, "all scenarios: "+limitReason)
+			}
+			for _, reason := range reasons {
+				logrus.Debugf("Skip scenario: %v", reason)
+			}
+
+			if randomScenario == nil {
+				<-slots
+				logrus.Infof("no eligible scenarios, backing off for %v seconds: %v", backoff, reasons)
+				triggered = cm.sleep(loopCtx, backoff)
+				if backoff *= 2; backoff > maxWait {
+					backoff = maxWait
+				}
+				continue
+			}
+		}
+		backoff = minWait
+
+		logrus.Infof("Triggering scenario: %v (%v)", randomScenario.GetName(), randomScenario.GetID())
+		cm.cooldowns.Hit(anyScenario, time.Now())
+		cm.cooldowns.Hit(randomScenario.GetID(), time.Now())
+		started++
+		wg.Add(1)
+		go func(s types.Scenario) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			scenarioCtx, cancel := cm.stopOnKillSwitch(ctx)
+			defer cancel()
+			cm.record(cm.execute(scenarioCtx, s))
+		}(randomScenario)
+		if cm.maxConcurrent == 1 {
+			wg.Wait()
 		}
 
 		// TODO: Notify interested parties?
 
-		randomInterval := cm.minWait + rand.Intn(cm.maxWait-cm.minWait)
+		randomInterval := minWait + cm.sharedInfo.Random.Intn("interval", maxWait-minWait)
 		logrus.Debugf("sleeping for randomInterval: %v before next run", randomInterval)
-		time.Sleep(time.Duration(randomInterval) * time.Second)
+		if cm.iterations > 0 && started >= cm.iterations {
+			continue
+		}
+		triggered = cm.sleep(loopCtx, randomInterval)
 	}
+
+	wg.Wait()
+	logrus.Infof("Stopping ChaosMonkey")
+	return nil
+}
+
+// sleep waits for the given number of seconds or until the context is
+// cancelled or the kill switch engaged. It returns early with the
+// scenario triggered through the API meanwhile, if any.
+func (cm *ChaosMonkey) sleep(ctx context.Context, seconds int) types.Scenario {
+	ctx, cancel := cm.stopOnKillSwitch(ctx)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case s := <-cm.triggers:
+		return s
+	}
+	return nil
+}
+
+// stopOnKillSwitch returns a context which is also cancelled when the
+// kill switch is engaged
+func (cm *ChaosMonkey) stopOnKillSwitch(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		cm.killSwitch.WaitEngaged(ctx)
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// setupExecution is the name under which the setup is journaled
+const setupExecution = "setup"
+
+// noProject returns true when planning in dry-run mode without a
+// chaosmonkey project, which would only be created by a real run
+func (cm *ChaosMonkey) noProject() bool {
+	return cm.cattleProjectID == utils.DryRunProjectID
 }
 
 // Setup does the initial setup of the cluster with the needed size
 // etc.
-func (cm *ChaosMonkey) Setup() error {
+func (cm *ChaosMonkey) Setup(ctx context.Context) error {
 	logrus.Debugf("Doing Setup for ChaosMonkey")
-	utils.SetupCluster(cm.sharedInfo)
-	return nil
+	if cm.noProject() {
+		logrus.Infof("[dry-run] no project to set up the cluster in")
+		return nil
+	}
+	ex := cm.newExecution(setupExecution)
+	err := ex.RunPhase(types.PhaseInject, func() error {
+		return utils.SetupCluster(types.WithExecution(ctx, ex), cm.sharedInfo)
+	})
+	ex.Finish()
+	cm.record(ex)
+	return err
+}
+
+// RunScenario runs the scenario once, through all its phases, even if it
+// is not eligible
+func (cm *ChaosMonkey) RunScenario(ctx context.Context, s types.Scenario) *types.Execution {
+	defer utils.CloseDockerProxies(cm.sharedInfo)
+
+	if cm.noProject() {
+		logrus.Infof("[dry-run] no project to run scenario %v in", s.GetID())
+		ex := cm.newExecution(s.GetID())
+		ex.Finish()
+		return ex
+	}
+
+	if eligible, reason := s.IsEligible(cm.sharedInfo); !eligible {
+		logrus.Warnf("scenario %v is not eligible, running it anyway: %v", s.GetID(), reason)
+	}
+	logrus.Infof("Triggering scenario: %v (%v)", s.GetName(), s.GetID())
+	ex := cm.execute(ctx, s)
+	cm.record(ex)
+	return ex
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/docker"
+	"github.com/leodotcloud/chaos-monkey/journal"
+	"github.com/leodotcloud/chaos-monkey/scenarios"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/urfave/cli"
+)
+
+func listScenarios(c *cli.Context) error {
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENABLED\tWEIGHT\tTAGS\tDESCRIPTION")
+	for _, info := range scenarios.List(o.scenarioFilter) {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", info.ID, info.Enabled, info.Weight,
+			strings.Join(info.Tags, ","), info.Description)
+	}
+	return w.Flush()
+}
+
+func runScenario(c *cli.Context) error {
+	id := c.Args().First()
+	if id == "" || c.NArg() > 1 {
+		err := fmt.Errorf("expecting exactly one scenario ID")
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	if _, ok := registry.Get(id); !ok {
+		err := fmt.Errorf("unknown scenario: %v, see list-scenarios", id)
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	s, err := scenarios.New(id, o.scenarioFilter)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	j, err := openJournal(c, o.sharedInfo)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	if j != nil {
+		defer j.Close()
+	}
+
+	cm, err := newChaosMonkey(ctx, o)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	closeJournals, err := openJournals(c, cm, j)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	defer closeJournals()
+
+	ex := cm.RunScenario(ctx, s)
+	if !ex.Succeeded() {
+		return cli.NewExitError(fmt.Sprintf("scenario %v failed", id), 1)
+	}
+	return nil
+}
+
+func setup(c *cli.Context) error {
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	cm, err := newChaosMonkey(ctx, o)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	defer utils.CloseDockerProxies(cm.sharedInfo)
+
+	if err := cm.Setup(ctx); err != nil {
+		logrus.Errorf("error setting up cluster: %v", err)
+		return err
+	}
+	return nil
+}
+
+func teardown(c *cli.Context) error {
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	si, project, err := connect(ctx, o)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	if project == nil {
+		logrus.Infof("no %v project, nothing to tear down", utils.ChaosMonkeyProjectName(si))
+		return nil
+	}
+
+	// The hosts created by the campaign of the journal are removed too, and
+	// the removals are journaled
+	ex := types.NewExecution(teardownExecution)
+	var created []types.Target
+	j, err := openJournal(c, si)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	if j != nil {
+		defer j.Close()
+		created = j.CreatedHosts()
+		j.Follow(ex)
+		defer func() {
+			ex.Finish()
+			if err := j.Write(ex); err != nil {
+				logrus.Errorf("error journaling teardown: %v", err)
+			}
+		}()
+	}
+
+	err = ex.RunPhase(types.PhaseInject, func() error {
+		return utils.Teardown(types.WithExecution(ctx, ex), si, project, created)
+	})
+	if err != nil {
+		logrus.Errorf("error tearing down: %v", err)
+		return err
+	}
+	return nil
+}
+
+// teardownExecution is the name under which the teardown is journaled
+const teardownExecution = "teardown"
+
+func status(c *cli.Context) error {
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	si, project, err := connect(context.Background(), o)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	if project == nil {
+		fmt.Fprintf(w, "project %v: not found\n", utils.ChaosMonkeyProjectName(si))
+		return nil
+	}
+	fmt.Fprintf(w, "project %v (%v): %v, owned: %v\n", project.Name, project.Id, project.State,
+		utils.IsOwnedProject(si, project))
+
+	hosts, err := utils.ListOwnedHosts(context.Background(), si)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nHOST\tID\tSTATE\tAGENT STATE\tRUN\n")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", host.Name, host.Id, host.State, host.AgentState,
+			host.Labels[utils.RunLabel])
+	}
+
+	stack, err := utils.FindOwnedStack(context.Background(), si, "cmstack-long")
+	if err != nil {
+		return err
+	}
+	if stack == nil {
+		fmt.Fprintf(w, "\nstack cmstack-long: not found\n")
+		return nil
+	}
+	fmt.Fprintf(w, "\nstack %v (%v): %v\n", stack.Name, stack.Id, stack.State)
+
+	services, err := si.Client.Service.List(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"stackId": stack.Id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nSERVICE\tID\tSTATE\tSCALE\n")
+	for _, service := range services.Data {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v/%v\n", service.Name, service.Id, service.State,
+			service.CurrentScale, service.Scale)
+	}
+	return nil
+}
+
+// connect connects to Rancher like newChaosMonkey, adopting the project
+// and resources of an older chaos monkey but without creating the
+// chaosmonkey project. The returned project is nil if there is none.
+func connect(ctx context.Context, o *options) (*types.SharedInfo, *client.Project, error) {
+	if o.cattleURL == "" {
+		return nil, nil, fmt.Errorf("Rancher URL not specified")
+	}
+
+	parsedURL, err := utils.GetParsedBaseURL(o.cattleURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	si := o.sharedInfo
+	si.RawClient, err = utils.GetRawClient(ctx, parsedURL, o.cattleAccessKey, o.cattleSecretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Marks the resources adopted
+	if si.Campaign == "" {
+		si.Campaign = journal.NewCampaignID()
+	}
+
+	var project *client.Project
+	if o.cattleProjectID != "" {
+		project, err = si.RawClient.Project.ById(o.cattleProjectID)
+	} else {
+		project, err = utils.FindOrAdoptChaosMonkeyProject(ctx, si)
+	}
+	if err != nil || project == nil {
+		return si, nil, err
+	}
+
+	si.Client, err = utils.GetClientForProject(ctx, parsedURL, project.Id, o.cattleAccessKey, o.cattleSecretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	si.Docker = docker.NewProxyExecutor(si.Client)
+	if err := utils.AdoptLegacyResources(ctx, si); err != nil {
+		return nil, nil, err
+	}
+	return si, project, nil
+}
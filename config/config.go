@@ -0,0 +1,291 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/scenarios"
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"gopkg.in/yaml.v2"
+)
+
+// Duration is a time.Duration written as a string, e.g. 15m
+type Duration time.Duration
+
+// UnmarshalYAML parses the duration from a string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Scenario configures a registered scenario
+type Scenario struct {
+	// Enabled, if set, overrides whether the scenario is enabled by default
+	Enabled       *bool        `yaml:"enabled"`
+	Weight        int          `yaml:"weight"`
+	VerifyTimeout Duration     `yaml:"verify_timeout"`
+	Cooldown      Duration     `yaml:"cooldown"`
+	MaxPerHour    int          `yaml:"max_per_hour"`
+	Params        types.Params `yaml:"params"`
+	Targets       Targets      `yaml:"targets"`
+}
+
+// Targets narrows down the resources a scenario acts on, with rules such
+// as stack=web,label.tier=front
+type Targets struct {
+	// Include replaces the default include rules of the scenario
+	Include selector.Rules `yaml:"include"`
+	// Exclude adds to the default exclude rules of the scenario
+	Exclude selector.Rules `yaml:"exclude"`
+}
+
+// Wait configures the random interval between scenarios, in seconds
+type Wait struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+// Cluster configures the number of hosts managed by the chaos monkey
+type Cluster struct {
+	Start int `yaml:"start"`
+	Min   int `yaml:"min"`
+	Max   int `yaml:"max"`
+}
+
+// DigitalOcean configures the DigitalOcean cloud provider
+type DigitalOcean struct {
+	Enabled     bool   `yaml:"enabled"`
+	AccessToken string `yaml:"access_token"`
+}
+
+// AWS configures the AWS cloud provider. The EC2 instances are created
+// with options picked at random among the ones listed.
+type AWS struct {
+	Enabled         bool     `yaml:"enabled"`
+	AccessKeyID     string   `yaml:"access_key_id"`
+	SecretAccessKey string   `yaml:"secret_access_key"`
+	Regions         []string `yaml:"regions"`
+	AMIs            []string `yaml:"amis"`
+	InstanceTypes   []string `yaml:"instance_types"`
+	VPCIDs          []string `yaml:"vpc_ids"`
+	SubnetIDs       []string `yaml:"subnet_ids"`
+	SecurityGroups  []string `yaml:"security_groups"`
+}
+
+// Packet configures the Packet cloud provider. The machines are created
+// with options picked at random among the ones listed.
+type Packet struct {
+	Enabled    bool     `yaml:"enabled"`
+	ProjectID  string   `yaml:"project_id"`
+	Token      string   `yaml:"token"`
+	OSes       []string `yaml:"oses"`
+	Plans      []string `yaml:"plans"`
+	Facilities []string `yaml:"facilities"`
+}
+
+// Providers configures the cloud providers used to add hosts
+type Providers struct {
+	DigitalOcean DigitalOcean `yaml:"digitalocean"`
+	AWS          AWS          `yaml:"aws"`
+	Packet       Packet       `yaml:"packet"`
+}
+
+// MinHealthy configures how many healthy instances a service is never
+// left below, as a count and as a percentage of its scale
+type MinHealthy struct {
+	Count   int `yaml:"count"`
+	Percent int `yaml:"percent"`
+}
+
+// BlastRadius limits the resources affected at once by the scenarios
+// running concurrently
+type BlastRadius struct {
+	Hosts     int `yaml:"hosts"`
+	Services  int `yaml:"services"`
+	Instances int `yaml:"instances"`
+}
+
+// SteadyState configures the probes checked before and after every
+// scenario
+type SteadyState struct {
+	Disabled bool     `yaml:"disabled"`
+	URLs     []string `yaml:"urls"`
+}
+
+// Config is the declarative definition of an experiment. Zero values
+// leave the corresponding flags, or their defaults, in effect.
+type Config struct {
+	Scenarios   map[string]Scenario `yaml:"scenarios"`
+	Tags        []string            `yaml:"tags"`
+	Wait        Wait                `yaml:"wait"`
+	Cluster     Cluster             `yaml:"cluster"`
+	Providers   Providers           `yaml:"providers"`
+	SteadyState SteadyState         `yaml:"steady_state"`
+	// Protected lists the resources no scenario ever acts on
+	Protected selector.Rules `yaml:"protected"`
+	// OptIn restricts the scenarios to the resources labeled
+	// io.rancher.chaos.enabled=true
+	OptIn      bool       `yaml:"opt_in"`
+	MinHealthy MinHealthy `yaml:"min_healthy"`
+	// MaxConcurrent is the number of scenarios run at once, within the
+	// blast radius
+	MaxConcurrent int         `yaml:"max_concurrent"`
+	BlastRadius   BlastRadius `yaml:"blast_radius"`
+	// MaxPerHour limits the scenarios started an hour, and TargetCooldown
+	// is the minimum time before an instance or host is hit again
+	MaxPerHour     int      `yaml:"max_per_hour"`
+	TargetCooldown Duration `yaml:"target_cooldown"`
+	Seed           int64    `yaml:"seed"`
+	Duration       Duration `yaml:"duration"`
+	Iterations     int      `yaml:"iterations"`
+}
+
+// Load reads and validates the configuration file at path. Both YAML and
+// JSON are accepted, as JSON is a subset of YAML.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %v", path, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+
+	return c, nil
+}
+
+// Validate checks the configuration, reporting all the problems found
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	var ids []string
+	for id := range c.Scenarios {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := c.Scenarios[id]
+		check(s.Weight >= 0, "scenarios.%v.weight: must not be negative", id)
+		check(s.VerifyTimeout >= 0, "scenarios.%v.verify_timeout: must not be negative", id)
+		check(s.Cooldown >= 0, "scenarios.%v.cooldown: must not be negative", id)
+		check(s.MaxPerHour >= 0, "scenarios.%v.max_per_hour: must not be negative", id)
+	}
+	f := c.ScenarioFilter()
+	if err := f.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("scenarios: %v", err))
+	}
+
+	check(c.Wait.Min >= 0, "wait.min: must not be negative")
+	check(c.Wait.Max >= 0, "wait.max: must not be negative")
+	check(c.Wait.Min == 0 || c.Wait.Max == 0 || c.Wait.Min < c.Wait.Max,
+		"wait: min (%v) must be less than max (%v)", c.Wait.Min, c.Wait.Max)
+
+	check(c.Cluster.Start >= 0, "cluster.start: must not be negative")
+	check(c.Cluster.Min >= 0, "cluster.min: must not be negative")
+	check(c.Cluster.Max >= 0, "cluster.max: must not be negative")
+	check(c.Cluster.Min == 0 || c.Cluster.Max == 0 || c.Cluster.Min <= c.Cluster.Max,
+		"cluster: min (%v) must not be more than max (%v)", c.Cluster.Min, c.Cluster.Max)
+	check(c.Cluster.Start == 0 || c.Cluster.Max == 0 || c.Cluster.Start <= c.Cluster.Max,
+		"cluster: start (%v) must not be more than max (%v)", c.Cluster.Start, c.Cluster.Max)
+
+	do := c.Providers.DigitalOcean
+	check(!do.Enabled || do.AccessToken != "",
+		"providers.digitalocean.access_token: required when enabled")
+	aws := c.Providers.AWS
+	check(!aws.Enabled || (aws.AccessKeyID != "" && aws.SecretAccessKey != ""),
+		"providers.aws: access_key_id and secret_access_key required when enabled")
+	packet := c.Providers.Packet
+	check(!packet.Enabled || (packet.ProjectID != "" && packet.Token != ""),
+		"providers.packet: project_id and token required when enabled")
+
+	for i, u := range c.SteadyState.URLs {
+		if err := ValidateURL(u); err != nil {
+			errs = append(errs, fmt.Sprintf("steady_state.urls[%v]: %v", i, err))
+		}
+	}
+
+	check(c.MinHealthy.Count >= 0, "min_healthy.count: must not be negative")
+	check(c.MinHealthy.Percent >= 0 && c.MinHealthy.Percent <= 100,
+		"min_healthy.percent: must be between 0 and 100")
+
+	check(c.MaxConcurrent >= 0, "max_concurrent: must not be negative")
+	check(c.BlastRadius.Hosts >= 0, "blast_radius.hosts: must not be negative")
+	check(c.BlastRadius.Services >= 0, "blast_radius.services: must not be negative")
+	check(c.BlastRadius.Instances >= 0, "blast_radius.instances: must not be negative")
+
+	check(c.MaxPerHour >= 0, "max_per_hour: must not be negative")
+	check(c.TargetCooldown >= 0, "target_cooldown: must not be negative")
+
+	check(c.Duration >= 0, "duration: must not be negative")
+	check(c.Iterations >= 0, "iterations: must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ValidateURL returns an error unless u is an absolute http(s) URL, as
+// checked by the steady state probes
+func ValidateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("not an http(s) URL: %v", u)
+	}
+	return nil
+}
+
+// ScenarioFilter returns the selection and tuning of the scenarios
+func (c *Config) ScenarioFilter() scenarios.Filter {
+	f := scenarios.Filter{
+		Tags:      c.Tags,
+		Overrides: map[string]scenarios.Override{},
+	}
+
+	for id, s := range c.Scenarios {
+		if s.Enabled != nil {
+			if *s.Enabled {
+				f.Enable = append(f.Enable, id)
+			} else {
+				f.Disable = append(f.Disable, id)
+			}
+		}
+		f.Overrides[id] = scenarios.Override{
+			Weight:        s.Weight,
+			VerifyTimeout: time.Duration(s.VerifyTimeout),
+			Cooldown:      time.Duration(s.Cooldown),
+			MaxPerHour:    s.MaxPerHour,
+			Params:        s.Params,
+			Targets: selector.Selector{
+				Include: s.Targets.Include,
+				Exclude: s.Targets.Exclude,
+			},
+		}
+	}
+
+	return f
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, name, data string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	c, err := load(t, "config.yaml", `
+scenarios:
+  reload-ipsec-api:
+    weight: 6
+    verify_timeout: 10m
+    params:
+      name_like: ipsec
+    targets:
+      include: ["host-label.zone=a"]
+  delete-host-api:
+    enabled: false
+wait: {min: 60, max: 300}
+steady_state:
+  urls: [http://example.com/health]
+target_cooldown: 30m
+`)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if c.Wait != (Wait{Min: 60, Max: 300}) {
+		t.Errorf("Wait = %+v", c.Wait)
+	}
+	if time.Duration(c.TargetCooldown) != 30*time.Minute {
+		t.Errorf("TargetCooldown = %v", time.Duration(c.TargetCooldown))
+	}
+
+	f := c.ScenarioFilter()
+	if len(f.Disable) != 1 || f.Disable[0] != "delete-host-api" {
+		t.Errorf("Disable = %v", f.Disable)
+	}
+	o := f.Overrides["reload-ipsec-api"]
+	if o.Weight != 6 || o.VerifyTimeout != 10*time.Minute || o.Params["name_like"] != "ipsec" {
+		t.Errorf("unexpected override %+v", o)
+	}
+	if len(o.Targets.Include) != 1 || o.Targets.Include[0].HostLabels["zone"] != "a" {
+		t.Errorf("unexpected targets %+v", o.Targets)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	c, err := load(t, "config.json", `{"wait": {"min": 10, "max": 20}, "max_per_hour": 5}`)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.Wait.Min != 10 || c.MaxPerHour != 5 {
+		t.Errorf("unexpected config %+v", c)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"unknown field", "colour: red", "colour"},
+		{"unknown scenario", "scenarios: {nope: {weight: 1}}", "unknown scenario: nope"},
+		{"unknown param", "scenarios: {add-host-api: {params: {size: big}}}", "unknown param size"},
+		{"param of another type", "scenarios: {add-host-api: {params: {count: abc}}}", `invalid value "abc" for param count`},
+		{"invalid rule", `protected: ["color=red"]`, "unknown key"},
+		{"invalid duration", "duration: forever", "forever"},
+	}
+
+	for _, test := range tests {
+		_, err := load(t, "config.yaml", test.data)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: Load returned %v, expecting an error about %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"valid", Config{Wait: Wait{Min: 1, Max: 2}}, ""},
+		{"negative weight", Config{Scenarios: map[string]Scenario{"add-host-api": {Weight: -1}}}, "scenarios.add-host-api.weight"},
+		{"wait", Config{Wait: Wait{Min: 2, Max: 1}}, "wait: min (2) must be less than max (1)"},
+		{"cluster", Config{Cluster: Cluster{Min: 5, Max: 3}}, "cluster: min (5)"},
+		{"cluster start", Config{Cluster: Cluster{Start: 5, Max: 3}}, "cluster: start (5)"},
+		{"digitalocean", Config{Providers: Providers{DigitalOcean: DigitalOcean{Enabled: true}}}, "providers.digitalocean.access_token"},
+		{"aws", Config{Providers: Providers{AWS: AWS{Enabled: true, AccessKeyID: "x"}}}, "providers.aws"},
+		{"packet", Config{Providers: Providers{Packet: Packet{Enabled: true, Token: "x"}}}, "providers.packet"},
+		{"steady state", Config{SteadyState: SteadyState{URLs: []string{"example.com/health"}}}, "steady_state.urls[0]"},
+		{"min healthy", Config{MinHealthy: MinHealthy{Percent: 101}}, "min_healthy.percent"},
+		{"blast radius", Config{BlastRadius: BlastRadius{Hosts: -1}}, "blast_radius.hosts"},
+	}
+
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%v: Validate failed: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: Validate returned %v, expecting an error about %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestValidateReportsAll(t *testing.T) {
+	c := Config{MaxConcurrent: -1, Iterations: -1}
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "max_concurrent") || !strings.Contains(err.Error(), "iterations") {
+		t.Errorf("Validate returned %v, expecting both problems", err)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"http://example.com/health", true},
+		{"https://example.com:8443", true},
+		{"example.com/health", false},
+		{"ftp://example.com", false},
+		{"http://", false},
+		{"http://[::1", false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateURL(test.url); (err == nil) != test.valid {
+			t.Errorf("ValidateURL(%q) = %v, expecting valid: %v", test.url, err, test.valid)
+		}
+	}
+}
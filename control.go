@@ -0,0 +1,167 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/api"
+	"github.com/leodotcloud/chaos-monkey/journal"
+	"github.com/leodotcloud/chaos-monkey/killswitch"
+	"github.com/leodotcloud/chaos-monkey/scenarios"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+// maxHistory is the number of finished executions kept for the API
+const maxHistory = 100
+
+func (cm *ChaosMonkey) getWait() (int, int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.minWait, cm.maxWait
+}
+
+func (cm *ChaosMonkey) addRunning(ex *types.Execution) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.running = append(cm.running, ex)
+}
+
+// addHistory keeps the finished execution for the API
+func (cm *ChaosMonkey) addHistory(ex *types.Execution) {
+	r := journal.NewRecord(cm.sharedInfo.Campaign, ex)
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for i, running := range cm.running {
+		if running == ex {
+			cm.running = append(cm.running[:i], cm.running[i+1:]...)
+			break
+		}
+	}
+	cm.history = append(cm.history, *r)
+	if len(cm.history) > maxHistory {
+		cm.history = cm.history[len(cm.history)-maxHistory:]
+	}
+}
+
+// Status ...
+func (cm *ChaosMonkey) Status() api.Status {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	reasons := cm.killSwitch.Reasons()
+	status := api.Status{
+		Campaign:     cm.sharedInfo.Campaign,
+		Paused:       len(reasons) > 0,
+		PauseReasons: reasons,
+		Wait:         api.Wait{Min: cm.minWait, Max: cm.maxWait},
+	}
+	// Only the fields which don't change once the executions started are
+	// safe to read here
+	for _, ex := range cm.running {
+		status.Running = append(status.Running, api.Current{
+			Scenario: ex.Scenario,
+			Start:    ex.Start,
+		})
+	}
+	if n := len(status.Running); n > 0 {
+		status.Current = &status.Running[n-1]
+	}
+	affected := cm.sharedInfo.BlastRadius.Affected()
+	status.Affected = api.Affected{
+		Hosts:     affected.Hosts,
+		Services:  affected.Services,
+		Instances: affected.Instances,
+	}
+	return status
+}
+
+// Pause ...
+func (cm *ChaosMonkey) Pause(reason string) {
+	cm.killSwitch.Engage(killswitch.SourceAPI, reason)
+}
+
+// Resume ...
+func (cm *ChaosMonkey) Resume() error {
+	cm.killSwitch.ReleaseExcept(killswitch.SourceFile)
+	return cm.paused()
+}
+
+// paused returns an *api.PausedError naming the sources of the kill
+// switch if it is engaged
+func (cm *ChaosMonkey) paused() error {
+	if sources := cm.killSwitch.Sources(); len(sources) > 0 {
+		return &api.PausedError{Sources: sources}
+	}
+	return nil
+}
+
+// Scenarios ...
+func (cm *ChaosMonkey) Scenarios() []api.Scenario {
+	var result []api.Scenario
+	for _, info := range scenarios.List(cm.scenarioFilter) {
+		cooldown := ""
+		if info.Cooldown > 0 {
+			cooldown = info.Cooldown.String()
+		}
+		result = append(result, api.Scenario{
+			ID:            info.ID,
+			Description:   info.Description,
+			Tags:          info.Tags,
+			Enabled:       info.Enabled,
+			Weight:        info.Weight,
+			VerifyTimeout: info.VerifyTimeout.String(),
+			Cooldown:      cooldown,
+			MaxPerHour:    info.MaxPerHour,
+			Params:        info.Params,
+		})
+	}
+	return result
+}
+
+// Trigger ...
+func (cm *ChaosMonkey) Trigger(id string) error {
+	if _, ok := registry.Get(id); !ok {
+		return api.ErrUnknownScenario
+	}
+	if err := cm.paused(); err != nil {
+		return err
+	}
+	if ready, reason := cm.cooldowns.Ready(anyScenario, time.Now(), 0, cm.maxPerHour); !ready {
+		logrus.Infof("not triggering scenario %v: %v", id, reason)
+		return api.ErrRateLimited
+	}
+	s, err := scenarios.New(id, cm.scenarioFilter)
+	if err != nil {
+		return err
+	}
+	select {
+	case cm.triggers <- s:
+		logrus.Infof("scenario %v triggered through the API", id)
+		return nil
+	default:
+		return api.ErrBusy
+	}
+}
+
+// Executions ...
+func (cm *ChaosMonkey) Executions(n int) []journal.Record {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if n > len(cm.history) {
+		n = len(cm.history)
+	}
+	return append([]journal.Record{}, cm.history[len(cm.history)-n:]...)
+}
+
+// SetWait ...
+func (cm *ChaosMonkey) SetWait(w api.Wait) error {
+	if w.Min < 0 || w.Min >= w.Max {
+		return api.ErrInvalidWait
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	logrus.Infof("wait between scenarios changed from %v-%v to %v-%v seconds",
+		cm.minWait, cm.maxWait, w.Min, w.Max)
+	cm.minWait, cm.maxWait = w.Min, w.Max
+	return nil
+}
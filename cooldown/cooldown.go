@@ -0,0 +1,77 @@
+package cooldown
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Window is the period over which the hits are limited
+const Window = time.Hour
+
+// Tracker remembers when keys, such as scenario IDs or targets, were hit.
+// A nil Tracker lets everything through.
+type Tracker struct {
+	mu     sync.Mutex
+	last   map[string]time.Time
+	recent map[string][]time.Time
+}
+
+// New returns an empty Tracker
+func New() *Tracker {
+	return &Tracker{
+		last:   map[string]time.Time{},
+		recent: map[string][]time.Time{},
+	}
+}
+
+// prune forgets the hits of the key which are out of the window
+func (t *Tracker) prune(key string, at time.Time) []time.Time {
+	var recent []time.Time
+	for _, hit := range t.recent[key] {
+		if at.Sub(hit) < Window {
+			recent = append(recent, hit)
+		}
+	}
+	if len(recent) == 0 {
+		delete(t.recent, key)
+	} else {
+		t.recent[key] = recent
+	}
+	return recent
+}
+
+// Hit records that the key was hit at the given time
+func (t *Tracker) Hit(key string, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[key] = at
+	t.recent[key] = append(t.prune(key, at), at)
+}
+
+// Ready returns whether the key can be hit at the given time, at least
+// cooldown after its last hit and with fewer than maxPerWindow hits in
+// the last Window, and if not, why. Zero values disable the limits.
+func (t *Tracker) Ready(key string, at time.Time, cooldown time.Duration, maxPerWindow int) (bool, string) {
+	if t == nil {
+		return true, ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[key]; ok && cooldown > 0 {
+		if since := at.Sub(last); since < cooldown {
+			return false, fmt.Sprintf("cooling down, last hit %v ago, %v left",
+				since, cooldown-since)
+		}
+	}
+	if maxPerWindow > 0 {
+		if hits := len(t.prune(key, at)); hits >= maxPerWindow {
+			return false, fmt.Sprintf("already hit %v times in the last %v, the maximum", hits, Window)
+		}
+	}
+	return true, ""
+}
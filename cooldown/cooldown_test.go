@@ -0,0 +1,58 @@
+package cooldown
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		hits     []time.Duration
+		at       time.Duration
+		cooldown time.Duration
+		max      int
+		want     bool
+	}{
+		{name: "never hit", at: 0, cooldown: time.Hour, max: 1, want: true},
+		{name: "no limits", hits: []time.Duration{0}, at: time.Second, want: true},
+		{name: "cooling down", hits: []time.Duration{0}, at: 10 * time.Minute, cooldown: 30 * time.Minute, want: false},
+		{name: "cooled down", hits: []time.Duration{0}, at: 30 * time.Minute, cooldown: 30 * time.Minute, want: true},
+		{name: "below the maximum", hits: []time.Duration{0}, at: time.Minute, max: 2, want: true},
+		{name: "at the maximum", hits: []time.Duration{0, time.Minute}, at: 2 * time.Minute, max: 2, want: false},
+		{name: "out of the window", hits: []time.Duration{0, time.Minute}, at: 61 * time.Minute, max: 2, want: true},
+	}
+
+	for _, test := range tests {
+		tracker := New()
+		for _, hit := range test.hits {
+			tracker.Hit("key", start.Add(hit))
+		}
+		ok, reason := tracker.Ready("key", start.Add(test.at), test.cooldown, test.max)
+		if ok != test.want {
+			t.Errorf("%v: Ready = %v (%v), expecting %v", test.name, ok, reason, test.want)
+		}
+		if !ok && reason == "" {
+			t.Errorf("%v: Ready gave no reason", test.name)
+		}
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	tracker := New()
+	at := time.Now()
+	tracker.Hit("a", at)
+	if ok, _ := tracker.Ready("b", at, time.Hour, 1); !ok {
+		t.Errorf("hitting a held back b")
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	tracker.Hit("key", time.Now())
+	if ok, _ := tracker.Ready("key", time.Now(), time.Hour, 1); !ok {
+		t.Errorf("a nil tracker held back a key")
+	}
+}
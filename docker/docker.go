@@ -0,0 +1,186 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	dc "github.com/docker/docker/client"
+	"github.com/leodotcloud/chaos-monkey/rancher"
+	"github.com/rancher/rancher-docker-api-proxy"
+)
+
+// APIVersion is the version of the docker API spoken to the daemons
+const APIVersion = "1.24"
+
+// Executor reaches the docker daemons of the hosts
+type Executor interface {
+	// Client returns a client of the docker daemon of the host
+	Client(ctx context.Context, hostID string) (*dc.Client, error)
+	// Close closes the connections to the daemons and waits for them
+	Close()
+}
+
+// NewClient returns a client of the docker daemon listening on the
+// address, such as unix:///var/run/docker.sock
+func NewClient(address string) (*dc.Client, error) {
+	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
+	return dc.NewClient(address, APIVersion, nil, defaultHeaders)
+}
+
+// proxy is a proxy to the docker daemon of a host, listening on a local
+// unix socket
+type proxy struct {
+	address string
+	// done is closed once the proxy has stopped serving
+	done <-chan struct{}
+	// close stops the proxy and waits for its socket to be removed
+	close func()
+}
+
+func (p *proxy) serving() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// ProxyExecutor reaches the docker daemons through the websocket proxies
+// of a Rancher server, started on demand for each host. It is safe for
+// concurrent use.
+type ProxyExecutor struct {
+	client *rancher.Client
+
+	mu      sync.Mutex
+	proxies map[string]*proxy
+}
+
+// NewProxyExecutor returns a ProxyExecutor reaching the hosts of the
+// client's project
+func NewProxyExecutor(client *rancher.Client) *ProxyExecutor {
+	return &ProxyExecutor{
+		client:  client,
+		proxies: map[string]*proxy{},
+	}
+}
+
+// Client returns a client of the docker daemon of the host, starting a
+// proxy to it unless one is still serving
+func (e *ProxyExecutor) Client(ctx context.Context, hostID string) (*dc.Client, error) {
+	address, err := e.address(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(address)
+}
+
+func (e *ProxyExecutor) address(ctx context.Context, hostID string) (string, error) {
+	e.mu.Lock()
+	p, ok := e.proxies[hostID]
+	e.mu.Unlock()
+	if ok {
+		if p.serving() {
+			return p.address, nil
+		}
+		logrus.Debugf("docker proxy for host %v has stopped, restarting", hostID)
+	}
+
+	return e.start(ctx, hostID)
+}
+
+// start starts a docker proxy for the host listening on a temporary unix
+// socket, which is removed when the proxy is closed
+func (e *ProxyExecutor) start(ctx context.Context, hostID string) (string, error) {
+	host, err := e.client.Host.ById(hostID)
+	if err != nil {
+		return "", err
+	}
+	if host == nil {
+		return "", fmt.Errorf("Can not find host %s", hostID)
+	}
+
+	if host.State != "active" {
+		return "", fmt.Errorf("Can not contact host %s in state %s", host.Hostname, host.State)
+	}
+
+	if e.client.API == nil {
+		return "", fmt.Errorf("Can not proxy docker on host %s without a Rancher server", host.Hostname)
+	}
+
+	tempfile, err := ioutil.TempFile("", "docker-sock")
+	if err != nil {
+		return "", err
+	}
+
+	if err := tempfile.Close(); err != nil {
+		return "", err
+	}
+
+	tempfileName := tempfile.Name()
+	dockerHost := "unix://" + tempfileName
+
+	logrus.Infof("starting proxy for dockerHost: %v", dockerHost)
+	dp := dockerapiproxy.NewProxy(e.client.API, host.Id, dockerHost)
+	if err := dp.Listen(); err != nil {
+		os.Remove(tempfileName)
+		return "", fmt.Errorf("error listening for proxy: %v", err)
+	}
+	logrus.Debugf("docker proxy started on %v", tempfileName)
+
+	done := make(chan struct{})
+	closing := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := dp.Serve()
+		select {
+		case <-closing:
+		default:
+			logrus.Errorf("docker proxy on %v stopped serving: %v", tempfileName, err)
+		}
+		os.Remove(tempfileName)
+	}()
+
+	started := &proxy{
+		address: dockerHost,
+		done:    done,
+		close: func() {
+			close(closing)
+			dp.Close()
+			<-done
+		},
+	}
+
+	e.mu.Lock()
+	existing, ok := e.proxies[hostID]
+	if ok && existing.serving() {
+		e.mu.Unlock()
+		// Another scenario started a proxy for the host meanwhile
+		started.close()
+		return existing.address, nil
+	}
+	e.proxies[hostID] = started
+	e.mu.Unlock()
+
+	return dockerHost, nil
+}
+
+// Close closes all the docker proxies which were started and waits for
+// their sockets to be removed
+func (e *ProxyExecutor) Close() {
+	e.mu.Lock()
+	proxies := e.proxies
+	e.proxies = map[string]*proxy{}
+	e.mu.Unlock()
+
+	for hostID, p := range proxies {
+		if p.serving() {
+			logrus.Debugf("closing docker proxy for host %v on %v", hostID, p.address)
+			p.close()
+		}
+	}
+}
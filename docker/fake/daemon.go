@@ -0,0 +1,368 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Call is a request received by a Daemon
+type Call struct {
+	// Op is the operation: list, inspect, remove, kill, pause,
+	// exec-create, exec-start or exec-inspect
+	Op string
+	// Container is the ID of the container operated on, if any
+	Container string
+	Method    string
+	Path      string
+	// Query holds the options of the operation, such as force or signal
+	Query map[string]string
+	// Cmd is the command of an exec
+	Cmd []string
+}
+
+// Container is a container of a Daemon
+type Container struct {
+	ID     string
+	Name   string
+	Image  string
+	Labels map[string]string
+	// State is running, paused or exited
+	State    string
+	ExitCode int
+}
+
+type exec struct {
+	id        string
+	container string
+	cmd       []string
+}
+
+// versionPrefix is the API version leading the paths, e.g. /v1.24
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// Daemon is a fake docker daemon listening on a unix socket. It
+// implements the listing, inspection, removal, killing and pausing of
+// containers, and the exec of commands in them, which do nothing, and
+// records the calls it receives. It is safe for concurrent use.
+type Daemon struct {
+	dir      string
+	listener net.Listener
+	server   *http.Server
+
+	mu         sync.Mutex
+	counter    int
+	containers []*Container
+	execs      map[string]*exec
+	calls      []Call
+}
+
+// NewDaemon starts a Daemon on a unix socket in a temporary directory
+func NewDaemon() (*Daemon, error) {
+	dir, err := ioutil.TempDir("", "fake-docker")
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	d := &Daemon{
+		dir:      dir,
+		listener: listener,
+		execs:    map[string]*exec{},
+	}
+	d.server = &http.Server{Handler: http.HandlerFunc(d.serve)}
+	go d.server.Serve(listener)
+	return d, nil
+}
+
+// Address returns the address of the Daemon, as given to a docker client
+func (d *Daemon) Address() string {
+	return "unix://" + d.listener.Addr().String()
+}
+
+// Close stops the Daemon and removes its socket
+func (d *Daemon) Close() {
+	d.listener.Close()
+	os.RemoveAll(d.dir)
+}
+
+// AddContainer adds a container, running unless its state is given, and
+// returns its ID, generated unless given
+func (d *Daemon) AddContainer(c Container) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.counter++
+	if c.ID == "" {
+		c.ID = fmt.Sprintf("%064x", d.counter)
+	}
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("container-%v", d.counter)
+	}
+	if c.State == "" {
+		c.State = "running"
+	}
+	d.containers = append(d.containers, &c)
+	return c.ID
+}
+
+// Container returns the container with the ID, or name, if it wasn't
+// removed
+func (d *Daemon) Container(id string) (Container, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c := d.find(id); c != nil {
+		return *c, true
+	}
+	return Container{}, false
+}
+
+// Calls returns the calls received so far
+func (d *Daemon) Calls() []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Call(nil), d.calls...)
+}
+
+// CallsTo returns the calls received so far operating on the container
+func (d *Daemon) CallsTo(id string) []Call {
+	var calls []Call
+	for _, call := range d.Calls() {
+		if call.Container == id {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// find returns the container with the ID, a unique prefix of it, or the
+// name
+func (d *Daemon) find(id string) *Container {
+	var found *Container
+	for _, c := range d.containers {
+		if c.ID == id || c.Name == strings.TrimPrefix(id, "/") {
+			return c
+		}
+		if strings.HasPrefix(c.ID, id) {
+			if found != nil {
+				return nil
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+func (d *Daemon) remove(c *Container) {
+	for i, existing := range d.containers {
+		if existing == c {
+			d.containers = append(d.containers[:i], d.containers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Daemon) record(r *http.Request, op, container string, cmd []string) {
+	query := map[string]string{}
+	for key, values := range r.URL.Query() {
+		query[key] = strings.Join(values, ",")
+	}
+	d.calls = append(d.calls, Call{
+		Op:        op,
+		Container: container,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     query,
+		Cmd:       cmd,
+	})
+}
+
+func (d *Daemon) serve(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := strings.Split(strings.Trim(versionPrefix.ReplaceAllString(r.URL.Path, ""), "/"), "/")
+	switch {
+	case r.Method == "GET" && len(path) == 1 && path[0] == "_ping":
+		w.Write([]byte("OK"))
+	case r.Method == "GET" && len(path) == 2 && path[0] == "containers" && path[1] == "json":
+		d.record(r, "list", "", nil)
+		d.list(w, r)
+	case len(path) >= 2 && path[0] == "containers":
+		d.container(w, r, path[1], path[2:])
+	case len(path) == 3 && path[0] == "exec":
+		d.exec(w, r, path[1], path[2])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (d *Daemon) list(w http.ResponseWriter, r *http.Request) {
+	args, err := filters.FromParam(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	all := r.URL.Query().Get("all")
+
+	list := []dtypes.Container{}
+	for _, c := range d.containers {
+		if all != "1" && all != "true" && c.State != "running" {
+			continue
+		}
+		if args.Include("id") && !args.Match("id", c.ID) ||
+			args.Include("name") && !args.Match("name", c.Name) ||
+			args.Include("status") && !args.ExactMatch("status", c.State) ||
+			args.Include("label") && !args.MatchKVList("label", c.Labels) {
+			continue
+		}
+		list = append(list, dtypes.Container{
+			ID:     c.ID,
+			Names:  []string{"/" + c.Name},
+			Image:  c.Image,
+			Labels: c.Labels,
+			State:  c.State,
+			Status: c.State,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (d *Daemon) container(w http.ResponseWriter, r *http.Request, id string, rest []string) {
+	c := d.find(id)
+	if c == nil {
+		d.record(r, "unknown", id, nil)
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+
+	op := ""
+	switch {
+	case r.Method == "GET" && len(rest) == 1 && rest[0] == "json":
+		op = "inspect"
+	case r.Method == "DELETE" && len(rest) == 0:
+		op = "remove"
+	case r.Method == "POST" && len(rest) == 1:
+		op = rest[0]
+	}
+
+	switch op {
+	case "inspect":
+		d.record(r, op, c.ID, nil)
+		writeJSON(w, http.StatusOK, inspect(c))
+	case "remove":
+		d.record(r, op, c.ID, nil)
+		force := r.URL.Query().Get("force")
+		if c.State != "exited" && force != "1" && force != "true" {
+			writeError(w, http.StatusConflict, "You cannot remove a running container "+c.ID)
+			return
+		}
+		d.remove(c)
+		w.WriteHeader(http.StatusNoContent)
+	case "kill":
+		d.record(r, op, c.ID, nil)
+		if c.State == "exited" {
+			writeError(w, http.StatusConflict, "Container "+c.ID+" is not running")
+			return
+		}
+		c.State, c.ExitCode = "exited", 137
+		w.WriteHeader(http.StatusNoContent)
+	case "pause":
+		d.record(r, op, c.ID, nil)
+		if c.State != "running" {
+			writeError(w, http.StatusConflict, "Container "+c.ID+" is not running")
+			return
+		}
+		c.State = "paused"
+		w.WriteHeader(http.StatusNoContent)
+	case "exec":
+		config := dtypes.ExecConfig{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		d.record(r, "exec-create", c.ID, config.Cmd)
+		if c.State != "running" {
+			writeError(w, http.StatusConflict, "Container "+c.ID+" is not running")
+			return
+		}
+		d.counter++
+		e := &exec{id: fmt.Sprintf("exec-%v", d.counter), container: c.ID, cmd: config.Cmd}
+		d.execs[e.id] = e
+		writeJSON(w, http.StatusCreated, dtypes.IDResponse{ID: e.id})
+	default:
+		d.record(r, "unknown", c.ID, nil)
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (d *Daemon) exec(w http.ResponseWriter, r *http.Request, id, op string) {
+	e, ok := d.execs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such exec instance: "+id)
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && op == "start":
+		d.record(r, "exec-start", e.container, e.cmd)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "GET" && op == "json":
+		d.record(r, "exec-inspect", e.container, e.cmd)
+		writeJSON(w, http.StatusOK, dtypes.ContainerExecInspect{
+			ExecID:      e.id,
+			ContainerID: e.container,
+		})
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func inspect(c *Container) dtypes.ContainerJSON {
+	return dtypes.ContainerJSON{
+		ContainerJSONBase: &dtypes.ContainerJSONBase{
+			ID:      c.ID,
+			Name:    "/" + c.Name,
+			Image:   c.Image,
+			Created: time.Unix(0, 0).UTC().Format(time.RFC3339Nano),
+			State: &dtypes.ContainerState{
+				Status:   c.State,
+				Running:  c.State == "running" || c.State == "paused",
+				Paused:   c.State == "paused",
+				ExitCode: c.ExitCode,
+			},
+		},
+		Config: &container.Config{
+			Image:  c.Image,
+			Labels: c.Labels,
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	dc "github.com/docker/docker/client"
+	"github.com/leodotcloud/chaos-monkey/docker"
+)
+
+// Executor reaches a Daemon per host. It is safe for concurrent use.
+type Executor struct {
+	mu      sync.Mutex
+	daemons map[string]*Daemon
+}
+
+// NewExecutor returns an Executor without any host
+func NewExecutor() *Executor {
+	return &Executor{
+		daemons: map[string]*Daemon{},
+	}
+}
+
+// Daemon returns the Daemon of the host, starting it if needed
+func (e *Executor) Daemon(hostID string) (*Daemon, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if d, ok := e.daemons[hostID]; ok {
+		return d, nil
+	}
+	d, err := NewDaemon()
+	if err != nil {
+		return nil, err
+	}
+	e.daemons[hostID] = d
+	return d, nil
+}
+
+// Client returns a client of the Daemon of the host, which must have
+// been started
+func (e *Executor) Client(ctx context.Context, hostID string) (*dc.Client, error) {
+	e.mu.Lock()
+	d, ok := e.daemons[hostID]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Can not contact host %s: no docker daemon", hostID)
+	}
+	return docker.NewClient(d.Address())
+}
+
+// Close leaves the daemons running, to be inspected, until Shutdown
+func (e *Executor) Close() {
+}
+
+// Shutdown stops the daemons of all the hosts
+func (e *Executor) Shutdown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for hostID, d := range e.daemons {
+		d.Close()
+		delete(e.daemons, hostID)
+	}
+}
@@ -0,0 +1,274 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+// Verification outcomes of an execution
+const (
+	VerificationPassed  = "passed"
+	VerificationFailed  = "failed"
+	VerificationSkipped = "skipped"
+)
+
+// Kinds of records
+const (
+	// KindExecution is the record of a finished execution
+	KindExecution = "execution"
+	// KindAction is the record of a single action, written as soon as it
+	// is taken
+	KindAction = "action"
+)
+
+// Phase is the journaled result of a phase of an execution
+type Phase struct {
+	Phase string    `json:"phase"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Record is the journal entry of a single scenario execution, or of an
+// action taken by one. Records without a kind predate the action records.
+type Record struct {
+	Campaign     string         `json:"campaign"`
+	Kind         string         `json:"kind,omitempty"`
+	Scenario     string         `json:"scenario"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Targets      []types.Target `json:"targets,omitempty"`
+	Actions      []types.Action `json:"actions,omitempty"`
+	Phases       []Phase        `json:"phases,omitempty"`
+	Errors       []string       `json:"errors,omitempty"`
+	Verification string         `json:"verification,omitempty"`
+}
+
+// NewRecord returns the journal entry of the execution
+func NewRecord(campaign string, ex *types.Execution) *Record {
+	r := &Record{
+		Campaign:     campaign,
+		Kind:         KindExecution,
+		Scenario:     ex.Scenario,
+		Start:        ex.Start,
+		End:          ex.End,
+		Targets:      ex.Targets,
+		Actions:      ex.Actions,
+		Verification: VerificationSkipped,
+	}
+
+	for _, p := range ex.Phases {
+		phase := Phase{
+			Phase: p.Phase,
+			Start: p.Start,
+			End:   p.End,
+		}
+		if p.Err != nil {
+			phase.Error = p.Err.Error()
+			r.Errors = append(r.Errors, fmt.Sprintf("%v: %v", p.Phase, p.Err))
+		}
+		r.Phases = append(r.Phases, phase)
+
+		if p.Phase == types.PhaseVerify {
+			r.Verification = VerificationPassed
+			if p.Err != nil {
+				r.Verification = VerificationFailed
+			}
+		}
+	}
+
+	return r
+}
+
+// Journal appends a JSON record per scenario execution, and per action
+// taken, to a file. The records of a previous run found in the file are
+// used to resume its campaign.
+type Journal struct {
+	mu           sync.Mutex
+	f            *os.File
+	enc          *json.Encoder
+	campaign     string
+	executions   int
+	createdHosts map[string]types.Target
+	loaded       []Record
+	terminated   bool
+}
+
+// Open opens the journal at path, creating it if needed. If the journal
+// already has records, the campaign they belong to is resumed, otherwise
+// a new campaign is started.
+func Open(path string) (*Journal, error) {
+	j := &Journal{
+		createdHosts: map[string]types.Target{},
+	}
+
+	if err := j.load(path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+	j.enc = json.NewEncoder(f)
+
+	// Terminate a partially written last record so that the next record
+	// starts on its own line
+	if info, err := f.Stat(); err == nil && info.Size() > 0 && !j.terminated {
+		if _, err := f.Write([]byte("\n")); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if j.campaign == "" {
+		j.campaign = NewCampaignID()
+	}
+
+	return j, nil
+}
+
+// NewCampaignID returns a new, unique identifier for a campaign
+func NewCampaignID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%v-%x", time.Now().UTC().Format("20060102-150405"), b)
+}
+
+func (j *Journal) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	j.terminated = len(data) == 0 || data[len(data)-1] == '\n'
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			// A crash may have left a partially written record
+			logrus.Warnf("skipping invalid journal record at line %v: %v", i+1, err)
+			continue
+		}
+		j.campaign = r.Campaign
+		j.apply(&r)
+		j.loaded = append(j.loaded, r)
+	}
+	return nil
+}
+
+// apply updates the state of the campaign with the record
+func (j *Journal) apply(r *Record) {
+	if r.Kind != KindAction {
+		j.executions++
+	}
+	// The actions of an execution were applied from their own records
+	if r.Kind == KindExecution {
+		return
+	}
+	for _, a := range r.Actions {
+		if a.Target.Kind != "host" {
+			continue
+		}
+		switch a.Verb {
+		case "create":
+			j.createdHosts[a.Target.ID] = a.Target
+		case "delete":
+			delete(j.createdHosts, a.Target.ID)
+		}
+	}
+}
+
+// Loaded returns the records found in the journal when it was opened
+func (j *Journal) Loaded() []Record {
+	return j.loaded
+}
+
+// Campaign returns the identifier of the campaign
+func (j *Journal) Campaign() string {
+	return j.campaign
+}
+
+// Executions returns the number of executions journaled in the campaign
+func (j *Journal) Executions() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.executions
+}
+
+// CreatedHosts returns the hosts created during the campaign which
+// haven't been deleted since
+func (j *Journal) CreatedHosts() []types.Target {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var hosts []types.Target
+	for _, host := range j.createdHosts {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Write journals the execution
+func (j *Journal) Write(ex *types.Execution) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r := NewRecord(j.campaign, ex)
+	if err := j.enc.Encode(r); err != nil {
+		return err
+	}
+	j.apply(r)
+	return j.f.Sync()
+}
+
+// WriteAction journals an action of the scenario as soon as it is taken,
+// so that the hosts it creates are known even if the run dies before the
+// execution finishes
+func (j *Journal) WriteAction(scenario string, a types.Action) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r := &Record{
+		Campaign: j.campaign,
+		Kind:     KindAction,
+		Scenario: scenario,
+		Start:    a.Time,
+		End:      a.Time,
+		Actions:  []types.Action{a},
+	}
+	if err := j.enc.Encode(r); err != nil {
+		return err
+	}
+	j.apply(r)
+	return j.f.Sync()
+}
+
+// Follow makes the journal record every action of the execution as soon
+// as it is taken
+func (j *Journal) Follow(ex *types.Execution) {
+	ex.OnAction = func(a types.Action) {
+		if err := j.WriteAction(ex.Scenario, a); err != nil {
+			logrus.Errorf("error journaling %v of %v %v: %v", a.Verb, a.Target.Kind, a.Target.Name, err)
+		}
+	}
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,126 @@
+package journal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+func tempJournal(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "journal.json"), func() { os.RemoveAll(dir) }
+}
+
+func host(id string) types.Target {
+	return types.Target{Kind: "host", ID: id, Name: "cmhost-" + id}
+}
+
+func TestNewRecord(t *testing.T) {
+	ex := types.NewExecution("delete-host-api")
+	ex.RunPhase(types.PhasePrecondition, func() error { return nil })
+	ex.RunPhase(types.PhaseInject, func() error { return nil })
+	ex.RunPhase(types.PhaseVerify, func() error { return errors.New("timed out") })
+	ex.Finish()
+
+	r := NewRecord("campaign", ex)
+	if r.Kind != KindExecution || r.Scenario != "delete-host-api" {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if r.Verification != VerificationFailed {
+		t.Errorf("verification is %v, expecting %v", r.Verification, VerificationFailed)
+	}
+	if len(r.Phases) != 3 || len(r.Errors) != 1 || r.Errors[0] != "verify: timed out" {
+		t.Errorf("unexpected phases %+v and errors %v", r.Phases, r.Errors)
+	}
+
+	skipped := types.NewExecution("add-host-api")
+	skipped.RunPhase(types.PhasePrecondition, func() error { return errors.New("not ready") })
+	if r := NewRecord("campaign", skipped); r.Verification != VerificationSkipped {
+		t.Errorf("verification is %v, expecting %v", r.Verification, VerificationSkipped)
+	}
+}
+
+func TestResume(t *testing.T) {
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	campaign := j.Campaign()
+
+	ex := types.NewExecution("add-host-api")
+	j.Follow(ex)
+	ex.AddAction("create", host("1h1"))
+	ex.AddAction("create", host("1h2"))
+	ex.Finish()
+	if err := j.Write(ex); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	ex = types.NewExecution("delete-host-api")
+	j.Follow(ex)
+	ex.AddAction("delete", host("1h1"))
+	// The run dies before the execution is written
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer j.Close()
+
+	if j.Campaign() != campaign {
+		t.Errorf("campaign %v was not resumed, got %v", campaign, j.Campaign())
+	}
+	if j.Executions() != 1 {
+		t.Errorf("Executions = %v, expecting 1", j.Executions())
+	}
+	created := j.CreatedHosts()
+	if len(created) != 1 || created[0].ID != "1h2" {
+		t.Errorf("CreatedHosts = %v, expecting 1h2", created)
+	}
+	// 3 actions and the execution
+	if got := len(j.Loaded()); got != 4 {
+		t.Errorf("loaded %v records, expecting 4", got)
+	}
+}
+
+func TestPartialRecord(t *testing.T) {
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	data := `{"campaign":"c1","kind":"execution","scenario":"a"}` + "\n" + `{"campaign":"c1","kind":"exec`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if j.Campaign() != "c1" || j.Executions() != 1 {
+		t.Errorf("campaign %v with %v executions, expecting c1 with 1", j.Campaign(), j.Executions())
+	}
+	if err := j.Write(types.NewExecution("b")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer j.Close()
+	if j.Executions() != 2 {
+		t.Errorf("the record after the partial one was lost, %v executions", j.Executions())
+	}
+}
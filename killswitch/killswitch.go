@@ -0,0 +1,234 @@
+package killswitch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// SourceFile engages the switch while the kill switch file exists
+	SourceFile = "file"
+	// SourceHTTP engages the switch through the HTTP endpoint
+	SourceHTTP = "http"
+	// SourceAPI engages the switch when pausing through the control API
+	SourceAPI = "api"
+	// SourceAbort engages the switch when an abort rule fires
+	SourceAbort = "abort"
+)
+
+// Switch pauses the injection of faults while it is engaged. It can be
+// engaged from several sources at once, and stays engaged until all of
+// them have released it.
+type Switch struct {
+	mu      sync.Mutex
+	reasons map[string]string
+	changed chan struct{}
+}
+
+// New returns a released switch
+func New() *Switch {
+	return &Switch{
+		reasons: map[string]string{},
+		changed: make(chan struct{}),
+	}
+}
+
+// Engage engages the switch from the source
+func (s *Switch) Engage(source, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.reasons[source]; ok && r == reason {
+		return
+	}
+	logrus.Warnf("kill switch engaged by %v: %v", source, reason)
+	s.reasons[source] = reason
+	s.notify()
+}
+
+// Release releases the switch from the source
+func (s *Switch) Release(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reasons[source]; !ok {
+		return
+	}
+	logrus.Infof("kill switch released by %v", source)
+	delete(s.reasons, source)
+	s.notify()
+}
+
+// ReleaseExcept releases the switch from all the sources but the given
+// ones
+func (s *Switch) ReleaseExcept(keep ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	released := false
+	for source := range s.reasons {
+		if contains(keep, source) {
+			continue
+		}
+		logrus.Infof("kill switch released by %v", source)
+		delete(s.reasons, source)
+		released = true
+	}
+	if released {
+		s.notify()
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// notify wakes up everyone waiting for a change, the lock must be held
+func (s *Switch) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Reasons returns why the switch is engaged, by source, or an empty map if
+// it is released
+func (s *Switch) Reasons() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reasons := map[string]string{}
+	for source, reason := range s.reasons {
+		reasons[source] = reason
+	}
+	return reasons
+}
+
+// Sources returns the sources engaging the switch, sorted
+func (s *Switch) Sources() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sources []string
+	for source := range s.reasons {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Engaged returns whether the switch is engaged
+func (s *Switch) Engaged() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.reasons) > 0
+}
+
+// WaitEngaged blocks until the switch is engaged or the context is
+// cancelled
+func (s *Switch) WaitEngaged(ctx context.Context) {
+	s.wait(ctx, true)
+}
+
+// WaitReleased blocks until the switch is released or the context is
+// cancelled
+func (s *Switch) WaitReleased(ctx context.Context) {
+	s.wait(ctx, false)
+}
+
+func (s *Switch) wait(ctx context.Context, engaged bool) {
+	for {
+		s.mu.Lock()
+		done := (len(s.reasons) > 0) == engaged
+		changed := s.changed
+		s.mu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// WatchFile engages the switch while the file exists, checking for it at
+// the given interval until the context is cancelled. Removing the file
+// also releases the switch engaged by an abort rule.
+func (s *Switch) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	existed := false
+	for {
+		_, err := os.Stat(path)
+		exists := err == nil
+		if exists {
+			s.Engage(SourceFile, "file "+path+" exists")
+		} else {
+			s.Release(SourceFile)
+			if existed {
+				s.Release(SourceAbort)
+			}
+		}
+		existed = exists
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// status is the representation of the switch served over HTTP
+type status struct {
+	Engaged bool              `json:"engaged"`
+	Reasons map[string]string `json:"reasons"`
+}
+
+// ServeHTTP shows the state of the switch on GET, engages it on POST,
+// with the optional reason query parameter, and releases it on DELETE.
+// DELETE also releases the switch engaged by an abort rule.
+func (s *Switch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "requested from " + r.RemoteAddr
+		}
+		s.Engage(SourceHTTP, reason)
+	case "DELETE":
+		s.Release(SourceHTTP)
+		s.Release(SourceAbort)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reasons := s.Reasons()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status{Engaged: len(reasons) > 0, Reasons: reasons})
+}
+
+// String describes why the switch is engaged
+func (s *Switch) String() string {
+	reasons := s.Reasons()
+	var sources []string
+	for source := range reasons {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	result := ""
+	for i, source := range sources {
+		if i > 0 {
+			result += "; "
+		}
+		result += source + ": " + reasons[source]
+	}
+	return result
+}
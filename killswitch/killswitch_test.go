@@ -0,0 +1,139 @@
+package killswitch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSources(t *testing.T) {
+	s := New()
+	if s.Engaged() {
+		t.Fatalf("a new switch is engaged")
+	}
+
+	s.Engage(SourceHTTP, "test")
+	s.Engage(SourceAbort, "too many hosts down")
+	if !s.Engaged() {
+		t.Fatalf("the switch is not engaged")
+	}
+	if got := s.Sources(); !reflect.DeepEqual(got, []string{SourceAbort, SourceHTTP}) {
+		t.Errorf("Sources = %v", got)
+	}
+
+	s.Release(SourceHTTP)
+	if !s.Engaged() {
+		t.Errorf("releasing one source released the switch engaged by another")
+	}
+	s.Release(SourceAbort)
+	if s.Engaged() {
+		t.Errorf("the switch is still engaged by %v", s.Sources())
+	}
+}
+
+func TestReleaseExcept(t *testing.T) {
+	s := New()
+	s.Engage(SourceFile, "file exists")
+	s.Engage(SourceAPI, "paused")
+	s.Engage(SourceAbort, "aborted")
+
+	s.ReleaseExcept(SourceFile)
+	if got := s.Sources(); !reflect.DeepEqual(got, []string{SourceFile}) {
+		t.Errorf("Sources = %v, expecting only %v", got, SourceFile)
+	}
+}
+
+func TestWaitReleased(t *testing.T) {
+	s := New()
+	s.Engage(SourceHTTP, "test")
+
+	done := make(chan struct{})
+	go func() {
+		s.WaitReleased(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("WaitReleased returned while engaged")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	s.Release(SourceHTTP)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("WaitReleased did not return once released")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "killswitch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stop")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New()
+	s.Engage(SourceAbort, "aborted")
+	go s.WatchFile(ctx, path, time.Millisecond)
+
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %v, sources: %v", what, s.Sources())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the file to engage the switch", func() bool {
+		return reflect.DeepEqual(s.Sources(), []string{SourceAbort, SourceFile})
+	})
+
+	// Removing the file also releases the abort
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the switch to be released", func() bool { return !s.Engaged() })
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := New()
+	s.Engage(SourceAbort, "aborted")
+
+	tests := []struct {
+		method  string
+		code    int
+		sources []string
+	}{
+		{"GET", http.StatusOK, []string{SourceAbort}},
+		{"POST", http.StatusOK, []string{SourceAbort, SourceHTTP}},
+		{"DELETE", http.StatusOK, nil},
+		{"PUT", http.StatusMethodNotAllowed, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(test.method, "/killswitch", nil))
+		if w.Code != test.code {
+			t.Errorf("%v returned %v, expecting %v", test.method, w.Code, test.code)
+		}
+		if got := s.Sources(); !reflect.DeepEqual(got, test.sources) {
+			t.Errorf("after %v the sources are %v, expecting %v", test.method, got, test.sources)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/probe"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+const (
+	// verifyInterval is how often the verification of a scenario is retried
+	verifyInterval = 10 * time.Second
+	// rollbackTimeout bounds the rollback done while shutting down
+	rollbackTimeout = 5 * time.Minute
+)
+
+// execute drives the scenario through its precondition, inject, verify
+// and rollback phases, recording the result of each in the returned
+// Execution. The steady state probes are part of the precondition and
+// of the verification. Rollback only happens if the injection or the
+// verification fails, or if the context is cancelled while they run: a
+// scenario which passed its verification is left alone.
+func (cm *ChaosMonkey) execute(ctx context.Context, s types.Scenario) *types.Execution {
+	si := cm.sharedInfo
+	ex := cm.newExecution(s.GetID())
+	defer ex.Finish()
+	defer si.BlastRadius.Release(ex)
+	cm.addRunning(ex)
+	runCtx := ctx
+	ctx = types.WithExecution(ctx, ex)
+
+	// The fault is only injected into a system in steady state
+	err := ex.RunPhase(types.PhasePrecondition, func() error {
+		if err := probe.Check(ctx, si, cm.probes); err != nil {
+			// The workload checked by the probes is only set up by a
+			// real run, the plan goes on
+			if !si.DryRun || ctx.Err() != nil {
+				return err
+			}
+			logrus.Infof("[dry-run] would skip scenario %v: %v", s.GetName(), err)
+		}
+		if p, ok := s.(types.Preconditioner); ok {
+			return p.Precondition(ctx, si)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Infof("precondition for scenario %v not met: %v", s.GetName(), err)
+		return ex
+	}
+
+	err = ex.RunPhase(types.PhaseInject, func() error {
+		return s.Run(ctx, si, ex)
+	})
+	if err != nil {
+		logrus.Infof("Error running scenario %v: %v", s.GetName(), err)
+	}
+	interrupted := runCtx.Err() != nil
+
+	v, _ := s.(types.Verifier)
+	verifyTimeout := types.DefaultVerifyTimeout
+	if v != nil {
+		verifyTimeout = v.GetVerifyTimeout()
+	}
+	if (v != nil || len(cm.probes) > 0) && err == nil && si.DryRun {
+		logrus.Infof("[dry-run] would verify recovery from scenario %v within %v",
+			s.GetName(), verifyTimeout)
+	} else if (v != nil || len(cm.probes) > 0) && err == nil {
+		err = ex.RunPhase(types.PhaseVerify, func() error {
+			return cm.waitForRecovery(ctx, v, verifyTimeout, ex)
+		})
+		if err != nil {
+			logrus.Infof("verification of scenario %v failed: %v", s.GetName(), err)
+		}
+		if err == nil {
+			// The system recovered, even if the run is shutting down
+			// meanwhile
+			interrupted = false
+		}
+	}
+
+	if r, ok := s.(types.RollBacker); ok && (err != nil || interrupted) {
+		rollbackCtx := ctx
+		if runCtx.Err() != nil {
+			// The run is shutting down, but the damage still needs to be
+			// undone
+			var cancel context.CancelFunc
+			rollbackCtx, cancel = context.WithTimeout(context.Background(), rollbackTimeout)
+			defer cancel()
+			rollbackCtx = types.WithExecution(rollbackCtx, ex)
+		}
+		err = ex.RunPhase(types.PhaseRollback, func() error {
+			return r.Rollback(rollbackCtx, si, ex)
+		})
+		if err != nil {
+			logrus.Errorf("rollback of scenario %v failed: %v", s.GetName(), err)
+		}
+	}
+
+	return ex
+}
+
+// waitForRecovery retries the verification of the scenario, if any, and
+// the steady state probes until they succeed, the timeout elapses or the
+// context is cancelled
+func (cm *ChaosMonkey) waitForRecovery(ctx context.Context, v types.Verifier, timeout time.Duration, ex *types.Execution) error {
+	si := cm.sharedInfo
+	deadline := time.Now().Add(timeout)
+	for {
+		var err error
+		if v != nil {
+			err = v.Verify(ctx, si, ex)
+		}
+		if err == nil {
+			err = probe.Check(ctx, si, cm.probes)
+		}
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not recovered after %v: %v", timeout, err)
+		}
+		logrus.Debugf("waiting for recovery: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyInterval):
+		}
+	}
+}
+
+// logExecution logs the result of each phase of the execution
+func logExecution(ex *types.Execution) {
+	for _, p := range ex.Phases {
+		result := "ok"
+		if p.Err != nil {
+			result = p.Err.Error()
+		}
+		logrus.Infof("scenario %v: %v took %v: %v",
+			ex.Scenario, p.Phase, p.End.Sub(p.Start), result)
+	}
+}
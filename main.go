@@ -1,181 +1,865 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/api"
+	"github.com/leodotcloud/chaos-monkey/blast"
+	"github.com/leodotcloud/chaos-monkey/config"
+	"github.com/leodotcloud/chaos-monkey/journal"
+	"github.com/leodotcloud/chaos-monkey/probe"
+	"github.com/leodotcloud/chaos-monkey/provider"
+	"github.com/leodotcloud/chaos-monkey/scenarios"
+	"github.com/leodotcloud/chaos-monkey/selector"
 	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
 	"github.com/urfave/cli"
 )
 
+// killSwitchFileInterval is how often the kill switch file is checked for
+const killSwitchFileInterval = 2 * time.Second
+
 // VERSION of the binary, that can be changed during build
 var VERSION = "v0.0.0-dev"
 
+// connectionFlags are needed to talk to Rancher
+var connectionFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "cattle-url",
+		Value:  "",
+		EnvVar: "CATTLE_URL",
+	},
+	cli.StringFlag{
+		Name:   "cattle-access-key",
+		Value:  "",
+		EnvVar: "CATTLE_ACCESS_KEY",
+	},
+	cli.StringFlag{
+		Name:   "cattle-project-id",
+		EnvVar: "CATTLE_PROJECT_ID",
+	},
+	cli.StringFlag{
+		Name:   "cattle-secret-key",
+		Value:  "",
+		EnvVar: "CATTLE_SECRET_KEY",
+	},
+	cli.StringFlag{
+		Name:   "instance-id",
+		Usage:  "ID of this chaos monkey among the ones sharing the Rancher server, the resources it creates are labeled with it",
+		Value:  utils.DefaultInstanceID,
+		EnvVar: "CHAOS_MONKEY_INSTANCE_ID",
+	},
+	cli.BoolFlag{
+		Name:   "dry-run",
+		Usage:  "Log the mutating actions with their targets instead of executing them",
+		EnvVar: "DRY_RUN",
+	},
+	cli.BoolFlag{
+		Name:  "debug",
+		Usage: "Turn on debug logging",
+	},
+}
+
+// configFlags read the experiment from a file
+var configFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "config",
+		Usage:  "Read the experiment from the given YAML or JSON file, flags given explicitly take precedence",
+		EnvVar: "CHAOS_MONKEY_CONFIG",
+	},
+}
+
+// clusterFlags size the cluster and choose where to add hosts
+var clusterFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "start-cluster-size",
+		Value: DefaultStartClusterSize,
+	},
+	cli.IntFlag{
+		Name:  "min-cluster-size",
+		Value: DefaultMinimumClusterSize,
+	},
+	cli.IntFlag{
+		Name:  "max-cluster-size",
+		Value: DefaultMaximumClusterSize,
+	},
+	cli.BoolFlag{
+		Name:   "use-digitalocean",
+		Usage:  "Use DigitalOcean Cloud Provider",
+		EnvVar: "USE_DIGITALOCEAN",
+	},
+	cli.StringFlag{
+		Name:   "digitalocean-access-token",
+		EnvVar: "DIGITALOCEAN_ACCESS_TOKEN",
+	},
+	cli.BoolFlag{
+		Name:   "use-aws",
+		Usage:  "Use AWS Cloud Provider",
+		EnvVar: "USE_AWS",
+	},
+	cli.StringFlag{
+		// The flag used to be named after the secret key
+		Name:   "aws-access-key-id, aws-secret-key-id",
+		EnvVar: "AWS_ACCESS_KEY_ID,AWS_SECRET_KEY_ID",
+	},
+	cli.StringFlag{
+		Name:   "aws-secret-access-key",
+		EnvVar: "AWS_SECRET_ACCESS_KEY",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-region",
+		Usage: "AWS region to create EC2 instances in, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-ami",
+		Usage: "AMI of the EC2 instances, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-instance-type",
+		Usage: "Type of the EC2 instances, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-vpc-id",
+		Usage: "VPC of the EC2 instances, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-subnet-id",
+		Usage: "Subnet of the EC2 instances, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "aws-security-group",
+		Usage: "Security group of the EC2 instances, picked at random (can be repeated)",
+	},
+	cli.BoolFlag{
+		Name:   "use-packet",
+		Usage:  "Use Packet Cloud Provider",
+		EnvVar: "USE_PACKET",
+	},
+	cli.StringFlag{
+		Name:   "packet-project-id",
+		EnvVar: "PACKET_PROJECT_ID",
+	},
+	cli.StringFlag{
+		Name:   "packet-token",
+		EnvVar: "PACKET_TOKEN",
+	},
+	cli.StringSliceFlag{
+		Name:  "packet-os",
+		Usage: "OS of the Packet machines, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "packet-plan",
+		Usage: "Plan of the Packet machines, picked at random (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "packet-facility",
+		Usage: "Facility to create Packet machines in, picked at random (can be repeated)",
+	},
+}
+
+// scenarioFlags select the scenarios
+var scenarioFlags = []cli.Flag{
+	cli.StringSliceFlag{
+		Name:  "enable-scenario",
+		Usage: "ID of a scenario to run, even if disabled by default (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "disable-scenario",
+		Usage: "ID of a scenario not to run (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "scenario-tag",
+		Usage: "Only run the scenarios having any of the given tags (can be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "protect",
+		Usage: "Rule matching resources no scenario may act on, e.g. stack=prod*,service=db (can be repeated)",
+	},
+	cli.IntFlag{
+		Name:  "min-healthy",
+		Usage: "Never leave a service with fewer healthy instances than this",
+		Value: utils.DefaultMinHealthy,
+	},
+	cli.IntFlag{
+		Name:  "min-healthy-percent",
+		Usage: "Never leave a service with a smaller percentage of its scale healthy than this",
+	},
+	cli.BoolFlag{
+		Name:   "opt-in",
+		Usage:  "Only act on the containers, services and hosts labeled io.rancher.chaos.enabled=true",
+		EnvVar: "CHAOS_MONKEY_OPT_IN",
+	},
+	cli.BoolFlag{
+		Name:   "disable-host-add-scenario",
+		Usage:  "Disable adding of Hosts during testing",
+		EnvVar: "DISALBLE_HOST_ADD_SCENARIO",
+	},
+	cli.BoolFlag{
+		Name:   "disable-host-del-scenario",
+		Usage:  "Disable deleting of Hosts during testing",
+		EnvVar: "DISALBLE_HOST_DEL_SCENARIO",
+	},
+}
+
+// steadyStateFlags define the steady state of the system
+var steadyStateFlags = []cli.Flag{
+	cli.StringSliceFlag{
+		Name:  "steady-state-url",
+		Usage: "URL which must return 200 for the system to be in steady state (can be repeated)",
+	},
+	cli.BoolFlag{
+		Name:  "disable-steady-state",
+		Usage: "Don't check the steady state of the system before and after every scenario",
+	},
+}
+
+// journalFlag appends the executions and their actions to a journal
+var journalFlag = cli.StringFlag{
+	Name:   "journal",
+	Usage:  "Append a JSON record of every scenario execution and action to the given file, resuming the campaign found in it",
+	EnvVar: "CHAOS_MONKEY_JOURNAL",
+}
+
+// journalFlags record and replay the executions and decisions
+var journalFlags = []cli.Flag{
+	cli.Int64Flag{
+		Name: "seed",
+	},
+	journalFlag,
+	cli.StringFlag{
+		Name:  "decision-journal",
+		Usage: "Write every random decision of the run to the given file, so that it can be replayed",
+	},
+	cli.StringFlag{
+		Name:  "replay",
+		Usage: "Repeat the scenario and target choices recorded in the given decision journal",
+	},
+}
+
+// loopFlags control the loop running random scenarios
+var loopFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "min-wait",
+		Value: DefaultMinWaitTime,
+	},
+	cli.IntFlag{
+		Name:  "max-wait",
+		Value: DefaultMaxWaitTime,
+	},
+	cli.DurationFlag{
+		Name:  "duration",
+		Usage: "Stop starting new scenarios after the given duration, e.g. 2h (default: run forever)",
+	},
+	cli.IntFlag{
+		Name:  "iterations",
+		Usage: "Stop after running the given number of scenarios (default: run forever)",
+	},
+	cli.IntFlag{
+		Name:  "max-concurrent",
+		Usage: "Run up to this many scenarios at once, on targets which don't overlap",
+		Value: 1,
+	},
+	cli.IntFlag{
+		Name:  "max-affected-hosts",
+		Usage: "Affect at most this many hosts at once (0 is unlimited)",
+	},
+	cli.IntFlag{
+		Name:  "max-affected-services",
+		Usage: "Affect at most this many services at once (0 is unlimited)",
+	},
+	cli.IntFlag{
+		Name:  "max-affected-instances",
+		Usage: "Affect at most this many instances at once (0 is unlimited)",
+	},
+	cli.IntFlag{
+		Name:  "max-per-hour",
+		Usage: "Start at most this many scenarios an hour (0 is unlimited)",
+	},
+	cli.DurationFlag{
+		Name:  "target-cooldown",
+		Usage: "Don't hit an instance or host again, or delete a host added, within the given duration, e.g. 15m",
+	},
+	cli.StringFlag{
+		Name:  "api-listen",
+		Usage: "Serve the control API on the given address",
+	},
+	cli.StringFlag{
+		Name:  "kill-switch-file",
+		Usage: "Pause the injection of faults while the given file exists",
+	},
+	cli.StringFlag{
+		Name:  "kill-switch-listen",
+		Usage: "Serve the kill switch on the given address, at /killswitch: POST engages it, DELETE releases it",
+	},
+	cli.IntFlag{
+		Name:  "abort-max-hosts-not-active",
+		Usage: "Abort when more hosts than this are not active, nor being created (0 disables)",
+		Value: DefaultAbortMaxHostsNotActive,
+	},
+	cli.IntFlag{
+		Name:  "abort-max-verify-failures",
+		Usage: "Abort when this many verifications fail within the abort-verify-failure-window (0 disables)",
+		Value: DefaultAbortMaxVerifyFailures,
+	},
+	cli.DurationFlag{
+		Name:  "abort-verify-failure-window",
+		Value: DefaultAbortVerifyFailureWindow,
+	},
+	cli.DurationFlag{
+		Name:  "abort-max-degraded",
+		Usage: "Abort when the cmstack-long stack stays degraded for longer than this (0 disables)",
+		Value: DefaultAbortMaxDegraded,
+	},
+	cli.StringFlag{
+		Name:  "alert-webhook",
+		Usage: "URL to post a JSON alert to when aborting",
+	},
+}
+
 func main() {
+	runFlags := flags(connectionFlags, configFlags, clusterFlags, scenarioFlags,
+		steadyStateFlags, journalFlags, loopFlags)
+
 	app := cli.NewApp()
 	app.Name = "chaos-monkey"
 	app.Version = VERSION
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:   "cattle-url",
-			Value:  "",
-			EnvVar: "CATTLE_URL",
-		},
-		cli.StringFlag{
-			Name:   "cattle-access-key",
-			Value:  "",
-			EnvVar: "CATTLE_ACCESS_KEY",
-		},
-		cli.StringFlag{
-			Name:   "cattle-project-id",
-			EnvVar: "CATTLE_PROJECT_ID",
-		},
-		cli.StringFlag{
-			Name:   "cattle-secret-key",
-			Value:  "",
-			EnvVar: "CATTLE_SECRET_KEY",
-		},
-		cli.IntFlag{
-			Name:  "start-cluster-size",
-			Value: DefaultStartClusterSize,
-		},
-		cli.IntFlag{
-			Name:  "min-cluster-size",
-			Value: DefaultMinimumClusterSize,
-		},
-		cli.IntFlag{
-			Name:  "max-cluster-size",
-			Value: DefaultMaximumClusterSize,
-		},
-		cli.IntFlag{
-			Name:  "min-wait",
-			Value: DefaultMinWaitTime,
-		},
-		cli.IntFlag{
-			Name:  "max-wait",
-			Value: DefaultMaxWaitTime,
-		},
-		cli.Int64Flag{
-			Name: "seed",
-		},
-		cli.BoolFlag{
-			Name:   "use-digitalocean",
-			Usage:  "Use DigitalOcean Cloud Provider",
-			EnvVar: "USE_DIGITALOCEAN",
-		},
-		cli.StringFlag{
-			Name:   "digitalocean-access-token",
-			EnvVar: "DIGITALOCEAN_ACCESS_TOKEN",
-		},
-		cli.BoolFlag{
-			Name:   "use-aws",
-			Usage:  "Use AWS Cloud Provider",
-			EnvVar: "USE_AWS",
+	app.Usage = "Inject faults into a Rancher environment"
+	// Running without a command keeps working as before the commands
+	// were added
+	app.Flags = runFlags
+	app.Action = run
+	app.Commands = []cli.Command{
+		{
+			Name:   "run",
+			Usage:  "Run random scenarios at random intervals",
+			Flags:  runFlags,
+			Action: run,
 		},
-		cli.StringFlag{
-			Name:   "aws-secret-key-id",
-			EnvVar: "AWS_SECRET_KEY_ID",
+		{
+			Name:   "list-scenarios",
+			Usage:  "List the registered scenarios",
+			Flags:  flags(configFlags, scenarioFlags),
+			Action: listScenarios,
 		},
-		cli.StringFlag{
-			Name:   "aws-secret-access-key",
-			EnvVar: "AWS_SECRET_ACCESS_KEY",
+		{
+			Name:      "run-scenario",
+			Usage:     "Run the given scenario once",
+			ArgsUsage: "<scenario-id>",
+			Flags:     flags(connectionFlags, configFlags, clusterFlags, scenarioFlags, steadyStateFlags, journalFlags),
+			Action:    runScenario,
 		},
-		cli.BoolFlag{
-			Name:   "use-packet",
-			Usage:  "Use Packet Cloud Provider",
-			EnvVar: "USE_PACKET",
+		{
+			Name:   "setup",
+			Usage:  "Only set up the cluster: the cmhost hosts and the cmstack-long stack",
+			Flags:  flags(connectionFlags, configFlags, clusterFlags),
+			Action: setup,
 		},
-		cli.StringFlag{
-			Name:   "packet-project-id",
-			EnvVar: "PACKET_PROJECT_ID",
+		{
+			Name:   "teardown",
+			Usage:  "Remove the resources created by the chaos monkey",
+			Flags:  flags(connectionFlags, []cli.Flag{journalFlag}),
+			Action: teardown,
 		},
-		cli.StringFlag{
-			Name:   "packet-token",
-			EnvVar: "PACKET_TOKEN",
+		{
+			Name:   "status",
+			Usage:  "Show the cmhost hosts, the cmstack-long stack and the chaosmonkey project",
+			Flags:  connectionFlags,
+			Action: status,
 		},
-		cli.BoolFlag{
-			Name:   "disable-host-add-scenario",
-			Usage:  "Disable adding of Hosts during testing",
-			EnvVar: "DISALBLE_HOST_ADD_SCENARIO",
+	}
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
+
+// flags concatenates the groups of flags
+func flags(groups ...[]cli.Flag) []cli.Flag {
+	var result []cli.Flag
+	for _, g := range groups {
+		result = append(result, g...)
+	}
+	return result
+}
+
+// definesFlag returns true if the command, or the app when running
+// without a command, has the flag
+func definesFlag(c *cli.Context, name string) bool {
+	names := c.FlagNames()
+	if c.Command.Name == "" {
+		names = c.GlobalFlagNames()
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// options are the settings of a command, taken from its flags and the
+// config file
+type options struct {
+	cattleURL          string
+	cattleAccessKey    string
+	cattleSecretKey    string
+	cattleProjectID    string
+	minWait            int
+	maxWait            int
+	seed               int64
+	duration           time.Duration
+	iterations         int
+	steadyStateURLs    []string
+	disableSteadyState bool
+	maxConcurrent      int
+	blastBudget        blast.Budget
+	maxPerHour         int
+	targetCooldown     time.Duration
+	scenarioFilter     scenarios.Filter
+	sharedInfo         *types.SharedInfo
+}
+
+// loadOptions reads the flags of the command, which don't need to define
+// all of them, and the config file
+func loadOptions(c *cli.Context) (*options, error) {
+	if c.Bool("debug") {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	o := &options{
+		cattleURL:          c.String("cattle-url"),
+		cattleAccessKey:    c.String("cattle-access-key"),
+		cattleSecretKey:    c.String("cattle-secret-key"),
+		cattleProjectID:    c.String("cattle-project-id"),
+		minWait:            c.Int("min-wait"),
+		maxWait:            c.Int("max-wait"),
+		seed:               c.Int64("seed"),
+		duration:           c.Duration("duration"),
+		iterations:         c.Int("iterations"),
+		steadyStateURLs:    c.StringSlice("steady-state-url"),
+		disableSteadyState: c.Bool("disable-steady-state"),
+		maxConcurrent:      c.Int("max-concurrent"),
+		maxPerHour:         c.Int("max-per-hour"),
+		targetCooldown:     c.Duration("target-cooldown"),
+		blastBudget: blast.Budget{
+			Hosts:     c.Int("max-affected-hosts"),
+			Services:  c.Int("max-affected-services"),
+			Instances: c.Int("max-affected-instances"),
 		},
-		cli.BoolFlag{
-			Name:   "disable-host-del-scenario",
-			Usage:  "Disable deleting of Hosts during testing",
-			EnvVar: "DISALBLE_HOST_DEL_SCENARIO",
+		scenarioFilter: scenarios.Filter{
+			Enable:  c.StringSlice("enable-scenario"),
+			Disable: c.StringSlice("disable-scenario"),
+			Tags:    c.StringSlice("scenario-tag"),
 		},
-		cli.BoolFlag{
-			Name:  "debug",
-			Usage: "Turn on debug logging",
+		sharedInfo: &types.SharedInfo{
+			UseDigitalOcean:         c.Bool("use-digitalocean"),
+			DigitalOceanAccessToken: c.String("digitalocean-access-token"),
+			UseAWS:                  c.Bool("use-aws"),
+			AWSAccessKeyID:          c.String("aws-access-key-id"),
+			AWSSecretAccessKey:      c.String("aws-secret-access-key"),
+			AWSRegions:              c.StringSlice("aws-region"),
+			AWSAMIs:                 c.StringSlice("aws-ami"),
+			AWSInstanceTypes:        c.StringSlice("aws-instance-type"),
+			AWSVPCIDs:               c.StringSlice("aws-vpc-id"),
+			AWSSubnetIDs:            c.StringSlice("aws-subnet-id"),
+			AWSSecurityGroups:       c.StringSlice("aws-security-group"),
+			UsePacket:               c.Bool("use-packet"),
+			PacketProjectID:         c.String("packet-project-id"),
+			PacketToken:             c.String("packet-token"),
+			PacketOSes:              c.StringSlice("packet-os"),
+			PacketPlans:             c.StringSlice("packet-plan"),
+			PacketFacilities:        c.StringSlice("packet-facility"),
+			DisableAddHostScenario:  c.Bool("disable-host-add-scenario"),
+			DisableDelHostScenario:  c.Bool("disable-host-del-scenario"),
+			DryRun:                  c.Bool("dry-run"),
+			OptIn:                   c.Bool("opt-in"),
+			MinHealthy:              c.Int("min-healthy"),
+			MinHealthyPercent:       c.Int("min-healthy-percent"),
+			InstanceID:              c.String("instance-id"),
+			StartClusterSize:        c.Int("start-cluster-size"),
+			MinClusterSize:          c.Int("min-cluster-size"),
+			MaxClusterSize:          c.Int("max-cluster-size"),
 		},
 	}
-	app.Action = run
-	app.Run(os.Args)
+
+	if !definesFlag(c, "min-healthy") {
+		o.sharedInfo.MinHealthy = utils.DefaultMinHealthy
+	}
+
+	if configFile := c.String("config"); configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return nil, err
+		}
+		o.scenarioFilter = mergeScenarioFilter(cfg.ScenarioFilter(), o.scenarioFilter)
+		applyConfig(c, cfg, o)
+		o.steadyStateURLs = append(o.steadyStateURLs, cfg.SteadyState.URLs...)
+		o.sharedInfo.Protected = append(o.sharedInfo.Protected, cfg.Protected...)
+		if cfg.SteadyState.Disabled && !c.IsSet("disable-steady-state") {
+			o.disableSteadyState = true
+		}
+	}
+
+	protected, err := selector.ParseRules(c.StringSlice("protect"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid protect rule: %v", err)
+	}
+	o.sharedInfo.Protected = append(o.sharedInfo.Protected, protected...)
+
+	for _, u := range c.StringSlice("steady-state-url") {
+		if err := config.ValidateURL(u); err != nil {
+			return nil, fmt.Errorf("invalid steady state URL: %v", err)
+		}
+	}
+
+	if err := o.scenarioFilter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if o.maxConcurrent < 1 {
+		return nil, fmt.Errorf("max concurrent (%v) must be at least 1", o.maxConcurrent)
+	}
+	if b := o.blastBudget; b.Hosts < 0 || b.Services < 0 || b.Instances < 0 {
+		return nil, fmt.Errorf("max affected hosts, services and instances must not be negative")
+	}
+	if o.maxPerHour < 0 || o.targetCooldown < 0 {
+		return nil, fmt.Errorf("max per hour (%v) and target cooldown (%v) must not be negative",
+			o.maxPerHour, o.targetCooldown)
+	}
+
+	if o.sharedInfo.MinHealthy < 0 || o.sharedInfo.MinHealthyPercent < 0 || o.sharedInfo.MinHealthyPercent > 100 {
+		return nil, fmt.Errorf("min healthy (%v) must not be negative and min healthy percent (%v) must be between 0 and 100",
+			o.sharedInfo.MinHealthy, o.sharedInfo.MinHealthyPercent)
+	}
+
+	if o.sharedInfo.InstanceID == "" {
+		// The command doesn't need to talk to Rancher
+		o.sharedInfo.InstanceID = utils.DefaultInstanceID
+	}
+	if err := utils.ValidateInstanceID(o.sharedInfo.InstanceID); err != nil {
+		return nil, err
+	}
+
+	si := o.sharedInfo
+	if si.MinClusterSize > si.StartClusterSize || si.StartClusterSize > si.MaxClusterSize {
+		return nil, fmt.Errorf("cluster sizes must satisfy min (%v) <= start (%v) <= max (%v)",
+			si.MinClusterSize, si.StartClusterSize, si.MaxClusterSize)
+	}
+	if err := provider.Validate(si); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// newChaosMonkey connects to Rancher, creating the chaosmonkey project if
+// no project is given
+func newChaosMonkey(ctx context.Context, o *options) (*ChaosMonkey, error) {
+	if o.cattleURL == "" {
+		return nil, fmt.Errorf("Rancher URL not specified")
+	}
+
+	//if o.cattleAccessKey == "" {
+	//	return nil, fmt.Errorf("Rancher Access Key not specified")
+	//}
+
+	//if o.cattleSecretKey == "" {
+	//	return nil, fmt.Errorf("Rancher Secret Key not specified")
+	//}
+
+	logrus.Debugf("cattle-url: %v", o.cattleURL)
+
+	cm, err := NewChaosMonkey(ctx, o.cattleURL, o.cattleProjectID, o.cattleAccessKey, o.cattleSecretKey,
+		o.minWait, o.maxWait, o.seed, o.duration, o.iterations,
+		o.scenarioFilter,
+		o.sharedInfo)
+	if err != nil {
+		return nil, fmt.Errorf("error creating chaos monkey: %v", err)
+	}
+
+	if !o.disableSteadyState {
+		cm.SetProbes(probe.Default(o.steadyStateURLs))
+	}
+
+	return cm, nil
+}
+
+// signalContext returns a context which is cancelled on SIGINT or
+// SIGTERM. A second signal exits right away.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logrus.Infof("received signal %v, shutting down", sig)
+		cancel()
+		sig = <-signals
+		logrus.Fatalf("received signal %v again, exiting without cleanup", sig)
+	}()
+	return ctx, cancel
+}
+
+// openJournals sets up the replay and the decision journal given by the
+// flags, and makes the chaos monkey write to the journal, if any, opened
+// by openJournal. The returned function closes the decision journal.
+func openJournals(c *cli.Context, cm *ChaosMonkey, j *journal.Journal) (func(), error) {
+	var closers []func() error
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	if replayFile := c.String("replay"); replayFile != "" {
+		f, err := os.Open(replayFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening replay file: %v", err)
+		}
+		err = cm.Replay(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading replay file %v: %v", replayFile, err)
+		}
+	}
+
+	if journalFile := c.String("decision-journal"); journalFile != "" {
+		f, err := os.OpenFile(journalFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening decision journal: %v", err)
+		}
+		closers = append(closers, f.Close)
+		if err := cm.JournalDecisions(f); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error writing decision journal: %v", err)
+		}
+	}
+
+	if j != nil {
+		cm.SetJournal(j)
+	}
+
+	return closeAll, nil
+}
+
+// openJournal opens the journal given by the flags, if any, and resumes
+// its campaign, so that the resources created are marked with it
+func openJournal(c *cli.Context, si *types.SharedInfo) (*journal.Journal, error) {
+	journalFile := c.String("journal")
+	if journalFile == "" {
+		return nil, nil
+	}
+	j, err := journal.Open(journalFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal: %v", err)
+	}
+	si.Campaign = j.Campaign()
+	return j, nil
 }
 
 func run(c *cli.Context) error {
-	var err error
-	if c.Bool("debug") {
-		logrus.SetLevel(logrus.DebugLevel)
+	o, err := loadOptions(c)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
 	}
 
-	cattleURL := c.String("cattle-url")
-	cattleAccessKey := c.String("cattle-access-key")
-	cattleSecretKey := c.String("cattle-secret-key")
-	cattleProjectID := c.String("cattle-project-id")
-	minWait := c.Int("min-wait")
-	maxWait := c.Int("max-wait")
-	seed := c.Int64("seed")
-
-	sharedInfo := &types.SharedInfo{
-		UseDigitalOcean:         c.Bool("use-digitalocean"),
-		DigitalOceanAccessToken: c.String("digitalocean-access-token"),
-		UseAWS:                  c.Bool("use-aws"),
-		AWSAccessKeyID:          c.String("aws-access-key-id"),
-		AWSSecretAccessKey:      c.String("aws-secret-access-key"),
-		UsePacket:               c.Bool("use-packet"),
-		PacketProjectID:         c.String("packet-project-id"),
-		PacketToken:             c.String("packet-token"),
-		DisableAddHostScenario:  c.Bool("disable-host-add-scenario"),
-		DisableDelHostScenario:  c.Bool("disable-host-del-scenario"),
-		StartClusterSize:        c.Int("start-cluster-size"),
-		MinClusterSize:          c.Int("min-cluster-size"),
-		MaxClusterSize:          c.Int("max-cluster-size"),
-	}
-
-	if cattleURL == "" {
-		err = fmt.Errorf("Rancher URL not specified")
+	if o.minWait < 0 || o.minWait >= o.maxWait {
+		err = fmt.Errorf("min wait (%v) must be at least 0 and less than max wait (%v)", o.minWait, o.maxWait)
 		logrus.Errorf("error: %v", err)
 		return err
 	}
 
-	//if cattleAccessKey == "" {
-	//	err = fmt.Errorf("Rancher Access Key not specified")
-	//	logrus.Errorf("error: %v", err)
-	//	return err
-	//}
+	ctx, cancel := signalContext()
+	defer cancel()
 
-	//if cattleSecretKey == "" {
-	//	err = fmt.Errorf("Rancher Secret Key not specified")
-	//	logrus.Errorf("error: %v", err)
-	//	return err
-	//}
+	j, err := openJournal(c, o.sharedInfo)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+	if j != nil {
+		defer j.Close()
+	}
 
-	logrus.Debugf("cattle-url: %v", cattleURL)
+	cm, err := newChaosMonkey(ctx, o)
+	if err != nil {
+		logrus.Errorf("error: %v", err)
+		return err
+	}
+
+	cm.SetConcurrency(o.maxConcurrent, o.blastBudget)
+	cm.SetRateLimits(o.maxPerHour, o.targetCooldown)
+	cm.SetAbortRules(AbortRules{
+		MaxHostsNotActive:   c.Int("abort-max-hosts-not-active"),
+		MaxVerifyFailures:   c.Int("abort-max-verify-failures"),
+		VerifyFailureWindow: c.Duration("abort-verify-failure-window"),
+		MaxDegraded:         c.Duration("abort-max-degraded"),
+		AlertWebhook:        c.String("alert-webhook"),
+	})
 
-	cm, err := NewChaosMonkey(cattleURL, cattleProjectID, cattleAccessKey, cattleSecretKey,
-		minWait, maxWait, seed,
-		sharedInfo)
+	if killSwitchFile := c.String("kill-switch-file"); killSwitchFile != "" {
+		go cm.KillSwitch().WatchFile(ctx, killSwitchFile, killSwitchFileInterval)
+	}
+
+	if address := c.String("kill-switch-listen"); address != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/killswitch", cm.KillSwitch())
+		if err := serve(ctx, address, mux); err != nil {
+			logrus.Errorf("error serving the kill switch: %v", err)
+			return err
+		}
+	}
+
+	closeJournals, err := openJournals(c, cm, j)
 	if err != nil {
-		logrus.Errorf("error creating chaos monkey: %v", err)
+		logrus.Errorf("error: %v", err)
 		return err
 	}
+	defer closeJournals()
 
-	if err := cm.Run(); err != nil {
+	if address := c.String("api-listen"); address != "" {
+		if err := serve(ctx, address, api.NewHandler(cm)); err != nil {
+			logrus.Errorf("error serving the API: %v", err)
+			return err
+		}
+	}
+
+	if err := cm.Run(ctx); err != nil {
 		logrus.Errorf("error running chaos monkey: %v", err)
 		return err
 	}
 
+	if cm.summary.verifyFailed > 0 {
+		return cli.NewExitError(
+			fmt.Sprintf("%v scenarios failed verification", cm.summary.verifyFailed), 1)
+	}
+
 	//<-make(chan struct{})
 	return nil
 }
+
+// mergeScenarioFilter combines the scenario selection of the config file
+// with the one given by flags, the flags winning on conflicts
+func mergeScenarioFilter(fromConfig, fromFlags scenarios.Filter) scenarios.Filter {
+	merged := fromConfig
+	merged.Enable = append(without(fromConfig.Enable, fromFlags.Disable), fromFlags.Enable...)
+	merged.Disable = append(without(fromConfig.Disable, fromFlags.Enable), fromFlags.Disable...)
+	if len(fromFlags.Tags) > 0 {
+		merged.Tags = fromFlags.Tags
+	}
+	return merged
+}
+
+func without(list, remove []string) []string {
+	var result []string
+	for _, s := range list {
+		found := false
+		for _, r := range remove {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// applyConfig takes the settings of the config file for which no flag
+// was given explicitly
+func applyConfig(c *cli.Context, cfg *config.Config, o *options) {
+	si := o.sharedInfo
+	setInt := func(flag string, value int, target *int) {
+		if value != 0 && !c.IsSet(flag) {
+			*target = value
+		}
+	}
+	setString := func(flag string, value string, target *string) {
+		if value != "" && !c.IsSet(flag) {
+			*target = value
+		}
+	}
+	setBool := func(flag string, value bool, target *bool) {
+		if value && !c.IsSet(flag) {
+			*target = value
+		}
+	}
+	setStrings := func(flag string, value []string, target *[]string) {
+		if len(value) > 0 && !c.IsSet(flag) {
+			*target = value
+		}
+	}
+
+	setInt("min-wait", cfg.Wait.Min, &o.minWait)
+	setInt("max-wait", cfg.Wait.Max, &o.maxWait)
+	setInt("start-cluster-size", cfg.Cluster.Start, &si.StartClusterSize)
+	setInt("min-cluster-size", cfg.Cluster.Min, &si.MinClusterSize)
+	setInt("max-cluster-size", cfg.Cluster.Max, &si.MaxClusterSize)
+	setInt("iterations", cfg.Iterations, &o.iterations)
+	if cfg.Seed != 0 && !c.IsSet("seed") {
+		o.seed = cfg.Seed
+	}
+	if cfg.Duration != 0 && !c.IsSet("duration") {
+		o.duration = time.Duration(cfg.Duration)
+	}
+	setInt("max-concurrent", cfg.MaxConcurrent, &o.maxConcurrent)
+	setInt("max-per-hour", cfg.MaxPerHour, &o.maxPerHour)
+	if cfg.TargetCooldown != 0 && !c.IsSet("target-cooldown") {
+		o.targetCooldown = time.Duration(cfg.TargetCooldown)
+	}
+	setInt("max-affected-hosts", cfg.BlastRadius.Hosts, &o.blastBudget.Hosts)
+	setInt("max-affected-services", cfg.BlastRadius.Services, &o.blastBudget.Services)
+	setInt("max-affected-instances", cfg.BlastRadius.Instances, &o.blastBudget.Instances)
+
+	setBool("opt-in", cfg.OptIn, &si.OptIn)
+	setInt("min-healthy", cfg.MinHealthy.Count, &si.MinHealthy)
+	setInt("min-healthy-percent", cfg.MinHealthy.Percent, &si.MinHealthyPercent)
+	setBool("use-digitalocean", cfg.Providers.DigitalOcean.Enabled, &si.UseDigitalOcean)
+	setString("digitalocean-access-token", cfg.Providers.DigitalOcean.AccessToken, &si.DigitalOceanAccessToken)
+	setBool("use-aws", cfg.Providers.AWS.Enabled, &si.UseAWS)
+	setString("aws-access-key-id", cfg.Providers.AWS.AccessKeyID, &si.AWSAccessKeyID)
+	setString("aws-secret-access-key", cfg.Providers.AWS.SecretAccessKey, &si.AWSSecretAccessKey)
+	setStrings("aws-region", cfg.Providers.AWS.Regions, &si.AWSRegions)
+	setStrings("aws-ami", cfg.Providers.AWS.AMIs, &si.AWSAMIs)
+	setStrings("aws-instance-type", cfg.Providers.AWS.InstanceTypes, &si.AWSInstanceTypes)
+	setStrings("aws-vpc-id", cfg.Providers.AWS.VPCIDs, &si.AWSVPCIDs)
+	setStrings("aws-subnet-id", cfg.Providers.AWS.SubnetIDs, &si.AWSSubnetIDs)
+	setStrings("aws-security-group", cfg.Providers.AWS.SecurityGroups, &si.AWSSecurityGroups)
+	setBool("use-packet", cfg.Providers.Packet.Enabled, &si.UsePacket)
+	setString("packet-project-id", cfg.Providers.Packet.ProjectID, &si.PacketProjectID)
+	setString("packet-token", cfg.Providers.Packet.Token, &si.PacketToken)
+	setStrings("packet-os", cfg.Providers.Packet.OSes, &si.PacketOSes)
+	setStrings("packet-plan", cfg.Providers.Packet.Plans, &si.PacketPlans)
+	setStrings("packet-facility", cfg.Providers.Packet.Facilities, &si.PacketFacilities)
+}
+
+// serve serves the handler on the address until the context is cancelled
+func serve(ctx context.Context, address string, handler http.Handler) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("listening on %v", l.Addr())
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		err := http.Serve(l, handler)
+		if ctx.Err() == nil {
+			logrus.Errorf("error serving on %v: %v", address, err)
+		}
+	}()
+	return nil
+}
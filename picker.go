@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/cooldown"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+// pickScenario draws one of the eligible scenarios which are not cooling
+// down, the probability of a scenario being picked being proportional to
+// its weight. If none of the scenarios are eligible, nil is returned
+// along with the reasons.
+func pickScenario(scenarios []types.Scenario, si *types.SharedInfo, cooldowns *cooldown.Tracker) (types.Scenario, []string) {
+	now := time.Now()
+	var eligible []types.Scenario
+	var ids []string
+	var weights []int
+	var reasons []string
+
+	for _, s := range scenarios {
+		ok, reason := s.IsEligible(si)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", s.GetID(), reason))
+			continue
+		}
+		if r, ok := s.(types.RateLimited); ok {
+			ready, reason := cooldowns.Ready(s.GetID(), now, r.GetCooldown(), r.GetMaxPerHour())
+			if !ready {
+				reasons = append(reasons, fmt.Sprintf("%v: %v", s.GetID(), reason))
+				continue
+			}
+		}
+		eligible = append(eligible, s)
+		ids = append(ids, s.GetID())
+		weights = append(weights, s.GetWeight())
+	}
+
+	if len(eligible) == 0 {
+		return nil, reasons
+	}
+
+	return eligible[si.Random.Choose("scenario", ids, weights)], reasons
+}
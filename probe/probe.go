@@ -0,0 +1,202 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// httpTimeout bounds a single request of an HTTP probe
+const httpTimeout = 10 * time.Second
+
+// DefaultStuckAfter is how long an instance stays in a transitioning
+// state before it is considered stuck
+const DefaultStuckAfter = 5 * time.Minute
+
+// Probe checks one aspect of the steady state of the system
+type Probe interface {
+	GetName() string
+	Check(ctx context.Context, si *types.SharedInfo) error
+}
+
+// Check evaluates all the probes, returning an error naming every probe
+// which failed
+func Check(ctx context.Context, si *types.SharedInfo, probes []Probe) error {
+	var failed []string
+	for _, p := range probes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.Check(ctx, si); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", p.GetName(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("not in steady state: %v", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Default returns the probes of the workload created by
+// utils.SetupCluster, followed by an HTTP probe for each of the URLs
+func Default(urls []string) []Probe {
+	probes := []Probe{
+		&StackActive{Stack: "cmstack-long"},
+		&HostsActive{},
+		&NoTransitioningInstances{StuckAfter: DefaultStuckAfter},
+	}
+	for _, url := range urls {
+		probes = append(probes, &HTTP{URL: url})
+	}
+	return probes
+}
+
+// StackActive checks that all the services of the owned stack are active
+// and at their expected scale
+type StackActive struct {
+	Stack string
+}
+
+// GetName ...
+func (p *StackActive) GetName() string {
+	return "stack " + p.Stack
+}
+
+// Check ...
+func (p *StackActive) Check(ctx context.Context, si *types.SharedInfo) error {
+	stack, err := utils.FindOwnedStack(ctx, si, p.Stack)
+	if err != nil {
+		return err
+	}
+	if stack == nil {
+		return fmt.Errorf("stack doesn't exist")
+	}
+
+	services, err := utils.ListServices(ctx, si, &client.ListOpts{
+		Filters: map[string]interface{}{
+			"stackId": stack.Id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		switch service.State {
+		case "removing", "removed", "purging", "purged":
+			continue
+		case "active":
+		default:
+			return fmt.Errorf("service %v is in state %v", service.Name, service.State)
+		}
+		if service.CurrentScale != service.Scale {
+			return fmt.Errorf("service %v is at scale %v instead of %v",
+				service.Name, service.CurrentScale, service.Scale)
+		}
+	}
+	return nil
+}
+
+// HostsActive checks that all the owned hosts are active
+type HostsActive struct{}
+
+// GetName ...
+func (p *HostsActive) GetName() string {
+	return "hosts"
+}
+
+// Check ...
+func (p *HostsActive) Check(ctx context.Context, si *types.SharedInfo) error {
+	return utils.CheckHostsConverged(ctx, si)
+}
+
+// NoTransitioningInstances checks that no instance is stuck in a
+// transitioning state, i.e. seen in the same one for StuckAfter or more
+type NoTransitioningInstances struct {
+	StuckAfter time.Duration
+
+	mu sync.Mutex
+	// since is when the instances were first seen in their transitioning
+	// state, by ID and state
+	since map[string]time.Time
+}
+
+// GetName ...
+func (p *NoTransitioningInstances) GetName() string {
+	return "instances"
+}
+
+// Check ...
+func (p *NoTransitioningInstances) Check(ctx context.Context, si *types.SharedInfo) error {
+	instances, err := si.Client.Instance.List(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"transitioning": "yes",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	since := map[string]time.Time{}
+	var names []string
+	for _, instance := range instances.Data {
+		if instance.Transitioning != "yes" {
+			continue
+		}
+		key := instance.Id + "/" + instance.State
+		first, ok := p.since[key]
+		if !ok {
+			first = now
+		}
+		since[key] = first
+		if now.Sub(first) >= p.StuckAfter {
+			names = append(names, fmt.Sprintf("%v (%v)", instance.Name, instance.State))
+		}
+	}
+	// The instances which settled are forgotten
+	p.since = since
+
+	if len(names) > 0 {
+		return fmt.Errorf("instances transitioning for %v or more: %v", p.StuckAfter, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// HTTP checks that a GET of the URL returns 200
+type HTTP struct {
+	URL string
+}
+
+// GetName ...
+func (p *HTTP) GetName() string {
+	return "http " + p.URL
+}
+
+// Check ...
+func (p *HTTP) Check(ctx context.Context, si *types.SharedInfo) error {
+	req, err := http.NewRequest("GET", p.URL, nil)
+	if err != nil {
+		return err
+	}
+	c := &http.Client{Timeout: httpTimeout}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+var (
+	doImages = []string{"centos-7-x64", "ubuntu-16-04-x64", "ubuntu-14-04-x64", "fedora-24-x64"}
+	//doSizes = []string{"1gb", "2gb", "4gb", "8gb", "16gb", "m-16gb"}
+	doSizes   = []string{"1gb", "2gb", "4gb", "8gb"}
+	doRegions = []string{"sfo1", "sfo2", "nyc1", "nyc2", "nyc3"}
+)
+
+// DigitalOcean creates droplets
+type DigitalOcean struct{}
+
+// Name ...
+func (DigitalOcean) Name() string {
+	return "DigitalOcean"
+}
+
+// Validate ...
+func (DigitalOcean) Validate(si *types.SharedInfo) error {
+	if si.DigitalOceanAccessToken == "" {
+		return fmt.Errorf("the access token is required")
+	}
+	return nil
+}
+
+// Configure picks the image, region and size of the droplet
+func (DigitalOcean) Configure(si *types.SharedInfo, host *client.Host) string {
+	// TODO: Make this configurable?
+	config := &client.DigitaloceanConfig{
+		AccessToken:       si.DigitalOceanAccessToken,
+		Backups:           false,
+		Image:             pick(si, "do-image", doImages),
+		PrivateNetworking: false,
+		Region:            pick(si, "do-region", doRegions),
+		Size:              pick(si, "do-size", doSizes),
+		SshUser:           "root",
+	}
+	host.DigitaloceanConfig = config
+	return fmt.Sprintf("image=%v region=%v size=%v", config.Image, config.Region, config.Size)
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+var (
+	// DefaultEC2Regions are the regions the instances are created in if
+	// none is configured
+	DefaultEC2Regions = []string{"us-west-2"}
+	// DefaultEC2InstanceTypes are the types of the instances if none is
+	// configured
+	DefaultEC2InstanceTypes = []string{"t2.medium", "t2.large", "m4.large"}
+	// DefaultEC2SecurityGroups are the security groups of the instances if
+	// none is configured, the one Rancher opens its ports in
+	DefaultEC2SecurityGroups = []string{"rancher-machine"}
+)
+
+// EC2 creates AWS EC2 instances. Without an AMI, VPC or subnet configured,
+// the machine driver uses the Ubuntu AMI, the default VPC and a subnet of
+// the region. As the AMIs, VPCs and subnets belong to a region, and the
+// subnets to a VPC, they are only configured along with a single region,
+// and the subnets with a single VPC, so that they are picked together.
+type EC2 struct{}
+
+// Name ...
+func (EC2) Name() string {
+	return "EC2"
+}
+
+func orDefault(options, defaults []string) []string {
+	if len(options) == 0 {
+		return defaults
+	}
+	return options
+}
+
+// Validate ...
+func (EC2) Validate(si *types.SharedInfo) error {
+	if si.AWSAccessKeyID == "" || si.AWSSecretAccessKey == "" {
+		return fmt.Errorf("the access key ID and secret access key are required")
+	}
+	regions := orDefault(si.AWSRegions, DefaultEC2Regions)
+	if len(regions) > 1 && (len(si.AWSAMIs) > 0 || len(si.AWSVPCIDs) > 0 || len(si.AWSSubnetIDs) > 0) {
+		return fmt.Errorf("AMIs, VPCs and subnets belong to a region, they can't be given along with several regions: %v",
+			regions)
+	}
+	if len(si.AWSVPCIDs) > 1 && len(si.AWSSubnetIDs) > 0 {
+		return fmt.Errorf("subnets belong to a VPC, they can't be given along with several VPCs: %v",
+			si.AWSVPCIDs)
+	}
+	return nil
+}
+
+// Configure picks the region, AMI, instance type, VPC, subnet and
+// security group of the instance
+func (EC2) Configure(si *types.SharedInfo, host *client.Host) string {
+	config := &client.Amazonec2Config{
+		AccessKey:    si.AWSAccessKeyID,
+		SecretKey:    si.AWSSecretAccessKey,
+		Region:       pick(si, "ec2-region", orDefault(si.AWSRegions, DefaultEC2Regions)),
+		Ami:          pick(si, "ec2-ami", si.AWSAMIs),
+		InstanceType: pick(si, "ec2-instance-type", orDefault(si.AWSInstanceTypes, DefaultEC2InstanceTypes)),
+		VpcId:        pick(si, "ec2-vpc", si.AWSVPCIDs),
+		SubnetId:     pick(si, "ec2-subnet", si.AWSSubnetIDs),
+		SecurityGroup: []string{
+			pick(si, "ec2-security-group", orDefault(si.AWSSecurityGroups, DefaultEC2SecurityGroups)),
+		},
+	}
+	host.Amazonec2Config = config
+	return fmt.Sprintf("region=%v ami=%v type=%v vpc=%v subnet=%v security-group=%v",
+		config.Region, config.Ami, config.InstanceType, config.VpcId, config.SubnetId, config.SecurityGroup[0])
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+var (
+	// DefaultPacketOSes are the operating systems of the machines if none
+	// is configured
+	DefaultPacketOSes = []string{"ubuntu_16_04", "centos_7"}
+	// DefaultPacketPlans are the plans of the machines if none is
+	// configured
+	DefaultPacketPlans = []string{"baremetal_0", "baremetal_1"}
+	// DefaultPacketFacilities are the facilities the machines are created
+	// in if none is configured
+	DefaultPacketFacilities = []string{"ewr1", "sjc1", "ams1"}
+)
+
+// Packet creates bare metal machines, billed hourly
+type Packet struct{}
+
+// Name ...
+func (Packet) Name() string {
+	return "Packet"
+}
+
+// Validate ...
+func (Packet) Validate(si *types.SharedInfo) error {
+	if si.PacketProjectID == "" || si.PacketToken == "" {
+		return fmt.Errorf("the project ID and token are required")
+	}
+	return nil
+}
+
+// Configure picks the OS, plan and facility of the machine
+func (Packet) Configure(si *types.SharedInfo, host *client.Host) string {
+	config := &client.PacketConfig{
+		ApiKey:       si.PacketToken,
+		ProjectId:    si.PacketProjectID,
+		BillingCycle: "hourly",
+		Os:           pick(si, "packet-os", orDefault(si.PacketOSes, DefaultPacketOSes)),
+		Plan:         pick(si, "packet-plan", orDefault(si.PacketPlans, DefaultPacketPlans)),
+		FacilityCode: pick(si, "packet-facility", orDefault(si.PacketFacilities, DefaultPacketFacilities)),
+	}
+	host.PacketConfig = config
+	return fmt.Sprintf("os=%v plan=%v facility=%v", config.Os, config.Plan, config.FacilityCode)
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// Provider creates the machines of the hosts added to the cluster on a
+// cloud, through the machine driver of Rancher, which also removes them
+// along with their hosts
+type Provider interface {
+	// Name is the name of the cloud, as logged
+	Name() string
+	// Configure picks the options of the machine of the host at random and
+	// sets its machine config. It returns the options, as logged.
+	Configure(si *types.SharedInfo, host *client.Host) string
+	// Validate returns an error if the options of the machines, and the
+	// credentials, can't be used to create them
+	Validate(si *types.SharedInfo) error
+}
+
+// Enabled returns the providers enabled in the shared info, DigitalOcean
+// if none is
+func Enabled(si *types.SharedInfo) []Provider {
+	var enabled []Provider
+	if si.UseDigitalOcean {
+		enabled = append(enabled, DigitalOcean{})
+	}
+	if si.UseAWS {
+		enabled = append(enabled, EC2{})
+	}
+	if si.UsePacket {
+		enabled = append(enabled, Packet{})
+	}
+	if len(enabled) == 0 {
+		enabled = append(enabled, DigitalOcean{})
+	}
+	return enabled
+}
+
+// Validate checks the options of the providers enabled in the shared
+// info. DigitalOcean, when used by default, is left to fail as it used to
+// when adding hosts.
+func Validate(si *types.SharedInfo) error {
+	if !si.UseDigitalOcean && !si.UseAWS && !si.UsePacket {
+		return nil
+	}
+	for _, p := range Enabled(si) {
+		if err := p.Validate(si); err != nil {
+			return fmt.Errorf("%v: %v", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Pick returns one of the enabled providers at random
+func Pick(si *types.SharedInfo) Provider {
+	enabled := Enabled(si)
+	if len(enabled) == 1 {
+		return enabled[0]
+	}
+	names := make([]string, len(enabled))
+	for i, p := range enabled {
+		names[i] = p.Name()
+	}
+	return enabled[si.Random.Choose("host-provider", names, nil)]
+}
+
+// pick returns one of the options at random, or the empty string if there
+// is none
+func pick(si *types.SharedInfo, kind string, options []string) string {
+	if len(options) == 0 {
+		return ""
+	}
+	return options[si.Random.Choose(kind, options, nil)]
+}
@@ -0,0 +1,295 @@
+package fake
+
+import (
+	"github.com/leodotcloud/chaos-monkey/rancher"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// Client returns a client of the project, or of the account if the
+// project is empty, as the chaos monkey uses them
+func (r *Rancher) Client(project string) *rancher.Client {
+	v := &view{r: r, project: project}
+	return &rancher.Client{
+		Host:            &hosts{v},
+		Instance:        &instances{v},
+		Container:       &containers{v},
+		Stack:           &stacks{v},
+		Service:         &services{v},
+		Project:         &projects{v},
+		ProjectTemplate: &projectTemplates{v},
+		ApiKey:          &apiKeys{v},
+	}
+}
+
+// view decodes the resources of the project into the go-rancher types
+type view struct {
+	r       *Rancher
+	project string
+}
+
+func (v *view) list(kind string, opts *client.ListOpts, collection interface{}) error {
+	var filters map[string]interface{}
+	if opts != nil {
+		filters = opts.Filters
+	}
+	list, err := v.r.List(v.project, kind, filters)
+	if err != nil {
+		return err
+	}
+	data := []interface{}{}
+	for _, res := range list {
+		data = append(data, res)
+	}
+	return fromResource(Resource{"type": "collection", "resourceType": kind, "data": data}, collection)
+}
+
+func (v *view) create(kind string, fields, resp interface{}) error {
+	res, err := toResource(fields)
+	if err != nil {
+		return err
+	}
+	created, err := v.r.Create(v.project, kind, res)
+	if err != nil {
+		return err
+	}
+	return fromResource(created, resp)
+}
+
+// byID returns false if there is no resource with the ID
+func (v *view) byID(kind, id string, resp interface{}) (bool, error) {
+	res, err := v.r.Get(v.project, kind, id)
+	if client.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, fromResource(res, resp)
+}
+
+func (v *view) update(kind, id string, updates, resp interface{}) error {
+	res, err := toResource(updates)
+	if err != nil {
+		return err
+	}
+	updated, err := v.r.Update(v.project, kind, id, res)
+	if err != nil {
+		return err
+	}
+	return fromResource(updated, resp)
+}
+
+func (v *view) action(kind, id, action string, resp interface{}) error {
+	res, err := v.r.Action(v.project, kind, id, action)
+	if err != nil {
+		return err
+	}
+	return fromResource(res, resp)
+}
+
+func (v *view) delete(kind, id string) error {
+	_, err := v.r.Delete(v.project, kind, id)
+	return err
+}
+
+type hosts struct{ *view }
+
+func (h *hosts) List(opts *client.ListOpts) (*client.HostCollection, error) {
+	resp := &client.HostCollection{}
+	return resp, h.list(HostKind, opts, resp)
+}
+
+func (h *hosts) Create(host *client.Host) (*client.Host, error) {
+	resp := &client.Host{}
+	return resp, h.create(HostKind, host, resp)
+}
+
+func (h *hosts) ById(id string) (*client.Host, error) {
+	resp := &client.Host{}
+	if found, err := h.byID(HostKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (h *hosts) Update(existing *client.Host, updates interface{}) (*client.Host, error) {
+	resp := &client.Host{}
+	return resp, h.update(HostKind, existing.Id, updates, resp)
+}
+
+func (h *hosts) Delete(host *client.Host) error {
+	return h.delete(HostKind, host.Id)
+}
+
+func (h *hosts) ActionDeactivate(host *client.Host) (*client.Host, error) {
+	resp := &client.Host{}
+	return resp, h.action(HostKind, host.Id, "deactivate", resp)
+}
+
+type instances struct{ *view }
+
+func (i *instances) List(opts *client.ListOpts) (*client.InstanceCollection, error) {
+	resp := &client.InstanceCollection{}
+	return resp, i.list(ContainerKind, opts, resp)
+}
+
+func (i *instances) ById(id string) (*client.Instance, error) {
+	resp := &client.Instance{}
+	if found, err := i.byID(ContainerKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (i *instances) ActionRestart(instance *client.Instance) (*client.Instance, error) {
+	resp := &client.Instance{}
+	return resp, i.action(ContainerKind, instance.Id, "restart", resp)
+}
+
+func (i *instances) ActionRemove(instance *client.Instance) (*client.Instance, error) {
+	resp := &client.Instance{}
+	return resp, i.action(ContainerKind, instance.Id, "remove", resp)
+}
+
+func (i *instances) ActionStart(instance *client.Instance) (*client.Instance, error) {
+	resp := &client.Instance{}
+	return resp, i.action(ContainerKind, instance.Id, "start", resp)
+}
+
+type containers struct{ *view }
+
+func (c *containers) ById(id string) (*client.Container, error) {
+	resp := &client.Container{}
+	if found, err := c.byID(ContainerKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+type stacks struct{ *view }
+
+func (s *stacks) List(opts *client.ListOpts) (*client.StackCollection, error) {
+	resp := &client.StackCollection{}
+	return resp, s.list(StackKind, opts, resp)
+}
+
+func (s *stacks) Create(stack *client.Stack) (*client.Stack, error) {
+	resp := &client.Stack{}
+	return resp, s.create(StackKind, stack, resp)
+}
+
+func (s *stacks) ById(id string) (*client.Stack, error) {
+	resp := &client.Stack{}
+	if found, err := s.byID(StackKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *stacks) Update(existing *client.Stack, updates interface{}) (*client.Stack, error) {
+	resp := &client.Stack{}
+	return resp, s.update(StackKind, existing.Id, updates, resp)
+}
+
+func (s *stacks) Delete(stack *client.Stack) error {
+	return s.delete(StackKind, stack.Id)
+}
+
+type services struct{ *view }
+
+func (s *services) List(opts *client.ListOpts) (*client.ServiceCollection, error) {
+	resp := &client.ServiceCollection{}
+	return resp, s.list(ServiceKind, opts, resp)
+}
+
+func (s *services) Create(service *client.Service) (*client.Service, error) {
+	resp := &client.Service{}
+	return resp, s.create(ServiceKind, service, resp)
+}
+
+func (s *services) ById(id string) (*client.Service, error) {
+	resp := &client.Service{}
+	if found, err := s.byID(ServiceKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *services) Update(existing *client.Service, updates interface{}) (*client.Service, error) {
+	resp := &client.Service{}
+	return resp, s.update(ServiceKind, existing.Id, updates, resp)
+}
+
+func (s *services) Delete(service *client.Service) error {
+	return s.delete(ServiceKind, service.Id)
+}
+
+func (s *services) ListInstances(service *client.Service) (*client.ContainerCollection, error) {
+	resp := &client.ContainerCollection{}
+	if err := s.list(ContainerKind, nil, resp); err != nil {
+		return nil, err
+	}
+	var data []client.Container
+	for _, c := range resp.Data {
+		for _, id := range c.ServiceIds {
+			if id == service.Id {
+				data = append(data, c)
+			}
+		}
+	}
+	resp.Data = data
+	return resp, nil
+}
+
+type projects struct{ *view }
+
+func (p *projects) List(opts *client.ListOpts) (*client.ProjectCollection, error) {
+	resp := &client.ProjectCollection{}
+	return resp, p.list(ProjectKind, opts, resp)
+}
+
+func (p *projects) Create(project *client.Project) (*client.Project, error) {
+	resp := &client.Project{}
+	return resp, p.create(ProjectKind, project, resp)
+}
+
+func (p *projects) ById(id string) (*client.Project, error) {
+	resp := &client.Project{}
+	if found, err := p.byID(ProjectKind, id, resp); !found {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *projects) Update(existing *client.Project, updates interface{}) (*client.Project, error) {
+	resp := &client.Project{}
+	return resp, p.update(ProjectKind, existing.Id, updates, resp)
+}
+
+func (p *projects) Delete(project *client.Project) error {
+	return p.delete(ProjectKind, project.Id)
+}
+
+func (p *projects) ActionDeactivate(project *client.Project) (*client.Account, error) {
+	resp := &client.Account{}
+	return resp, p.action(ProjectKind, project.Id, "deactivate", resp)
+}
+
+func (p *projects) ActionPurge(project *client.Project) (*client.Account, error) {
+	resp := &client.Account{}
+	return resp, p.action(ProjectKind, project.Id, "purge", resp)
+}
+
+type projectTemplates struct{ *view }
+
+func (p *projectTemplates) List(opts *client.ListOpts) (*client.ProjectTemplateCollection, error) {
+	resp := &client.ProjectTemplateCollection{}
+	return resp, p.list(ProjectTemplateKind, opts, resp)
+}
+
+type apiKeys struct{ *view }
+
+func (a *apiKeys) Create(key *client.ApiKey) (*client.ApiKey, error) {
+	resp := &client.ApiKey{}
+	return resp, a.create(ApiKeyKind, key, resp)
+}
@@ -0,0 +1,593 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+// The kinds of resources simulated, named as their Rancher schemas
+const (
+	HostKind            = "host"
+	ContainerKind       = "container"
+	StackKind           = "stack"
+	ServiceKind         = "service"
+	ProjectKind         = "project"
+	ProjectTemplateKind = "projectTemplate"
+	ApiKeyKind          = "apiKey"
+)
+
+// idPrefixes are the prefixes of the IDs Rancher gives to each kind
+var idPrefixes = map[string]string{
+	HostKind:            "1h",
+	ContainerKind:       "1i",
+	StackKind:           "1st",
+	ServiceKind:         "1s",
+	ProjectKind:         "1a",
+	ProjectTemplateKind: "1pt",
+	ApiKeyKind:          "1c",
+}
+
+// scoped are the kinds which belong to a project
+var scoped = map[string]bool{
+	HostKind:      true,
+	ContainerKind: true,
+	StackKind:     true,
+	ServiceKind:   true,
+	ApiKeyKind:    true,
+}
+
+// transition is a change of state started by an action
+type transition struct {
+	from []string
+	via  string
+}
+
+// actions are the actions available on each kind, and delete is the
+// removal of a resource
+var actions = map[string]map[string]transition{
+	HostKind: {
+		"activate":   {[]string{"inactive"}, "activating"},
+		"deactivate": {[]string{"active"}, "deactivating"},
+		"delete":     {[]string{"inactive"}, "removing"},
+	},
+	ContainerKind: {
+		"start":   {[]string{"stopped"}, "starting"},
+		"stop":    {[]string{"running"}, "stopping"},
+		"restart": {[]string{"running"}, "restarting"},
+		"remove":  {[]string{"running", "stopped"}, "removing"},
+		"delete":  {[]string{"running", "stopped"}, "removing"},
+	},
+	StackKind: {
+		"activate": {[]string{"inactive"}, "activating"},
+		"delete":   {[]string{"active", "inactive"}, "removing"},
+	},
+	ServiceKind: {
+		"activate":   {[]string{"inactive"}, "activating"},
+		"deactivate": {[]string{"active"}, "deactivating"},
+		"delete":     {[]string{"active", "inactive"}, "removing"},
+	},
+	ProjectKind: {
+		"activate":   {[]string{"inactive"}, "activating"},
+		"deactivate": {[]string{"active"}, "deactivating"},
+		"delete":     {[]string{"inactive"}, "removing"},
+		"purge":      {[]string{"removed"}, "purging"},
+	},
+	ApiKeyKind: {
+		"delete": {[]string{"active"}, "removing"},
+	},
+}
+
+// settled are the states reached by the transitional states
+var settled = map[string]string{
+	"activating":   "active",
+	"deactivating": "inactive",
+	"removing":     "removed",
+	"purging":      "purged",
+	"starting":     "running",
+	"stopping":     "stopped",
+	"restarting":   "running",
+}
+
+// initial are the states of the resources created through the API
+var initial = map[string]string{
+	HostKind:            "activating",
+	ContainerKind:       "starting",
+	StackKind:           "activating",
+	ServiceKind:         "activating",
+	ProjectKind:         "activating",
+	ProjectTemplateKind: "active",
+	ApiKeyKind:          "active",
+}
+
+// Resource is a resource as it is serialized by the API
+type Resource map[string]interface{}
+
+func (r Resource) str(field string) string {
+	if v, ok := r[field]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Rancher simulates in memory the part of a Rancher server used by the
+// chaos monkey. The transitional states, such as activating, last until
+// the next API call, which settles them. The services are scaled as
+// Rancher would, on the active hosts of their project.
+type Rancher struct {
+	mu        sync.Mutex
+	counter   int
+	resources map[string][]Resource
+}
+
+// New returns an empty Rancher
+func New() *Rancher {
+	return &Rancher{
+		resources: map[string][]Resource{},
+	}
+}
+
+func notFound(kind, id string) error {
+	return &client.ApiError{
+		StatusCode: http.StatusNotFound,
+		Status:     "404 Not Found",
+		Msg:        fmt.Sprintf("%v %v not found", kind, id),
+	}
+}
+
+func invalidState(kind, id, action, state string) error {
+	return &client.ApiError{
+		StatusCode: http.StatusConflict,
+		Status:     "409 Conflict",
+		Msg:        fmt.Sprintf("can not %v %v %v in state %v", action, kind, id, state),
+	}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &client.ApiError{
+		StatusCode: 422,
+		Status:     "422 Unprocessable Entity",
+		Msg:        fmt.Sprintf(format, args...),
+	}
+}
+
+func toResource(v interface{}) (Resource, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	r := Resource{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func fromResource(r Resource, v interface{}) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func copyResource(r Resource) Resource {
+	c, _ := toResource(r)
+	return c
+}
+
+// Kinds returns the kinds of resources simulated
+func Kinds() []string {
+	var kinds []string
+	for kind := range idPrefixes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Actions returns the actions available on a resource in its state
+func Actions(kind string, r Resource) []string {
+	var available []string
+	for action, t := range actions[kind] {
+		if action == "delete" {
+			continue
+		}
+		for _, from := range t.from {
+			if r.str("state") == from {
+				available = append(available, action)
+			}
+		}
+	}
+	sort.Strings(available)
+	return available
+}
+
+// List returns the resources of the kind in the project, or in every
+// project if none, matching the filters
+func (r *Rancher) List(project, kind string, filters map[string]interface{}) ([]Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tick()
+
+	if _, ok := idPrefixes[kind]; !ok {
+		return nil, invalid("unknown kind %v", kind)
+	}
+	var list []Resource
+	for _, res := range r.resources[kind] {
+		if r.visible(project, kind, res) && Matches(res, filters) {
+			list = append(list, copyResource(res))
+		}
+	}
+	return list, nil
+}
+
+// Get returns the resource of the kind with the given ID
+func (r *Rancher) Get(project, kind, id string) (Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tick()
+
+	res, err := r.find(project, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	return copyResource(res), nil
+}
+
+// Create creates a resource of the kind in the project, in the state
+// Rancher gives to new resources
+func (r *Rancher) Create(project, kind string, fields Resource) (Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tick()
+
+	res := copyResource(fields)
+	switch kind {
+	case HostKind, StackKind, ProjectKind:
+		if res.str("name") == "" && res.str("hostname") == "" {
+			return nil, invalid("%v name is required", kind)
+		}
+	case ServiceKind:
+		if _, err := r.find(project, StackKind, res.str("stackId")); err != nil {
+			return nil, invalid("stack %v of service %v not found", res.str("stackId"), res.str("name"))
+		}
+	case ApiKeyKind:
+		r.counter++
+		res["publicValue"] = fmt.Sprintf("fake-public-%v", r.counter)
+		res["secretValue"] = fmt.Sprintf("fake-secret-%v", r.counter)
+	case ContainerKind:
+	default:
+		return nil, invalid("can not create %v", kind)
+	}
+	res["state"] = initial[kind]
+	return copyResource(r.add(project, kind, res)), nil
+}
+
+// Update updates the fields of the resource of the kind with the given ID
+func (r *Rancher) Update(project, kind, id string, updates Resource) (Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tick()
+
+	res, err := r.find(project, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	for field, value := range copyResource(updates) {
+		switch field {
+		case "id", "type", "state", "accountId", "links", "actions":
+			continue
+		}
+		res[field] = value
+	}
+	r.settle(res)
+	return copyResource(res), nil
+}
+
+// Delete removes the resource of the kind with the given ID
+func (r *Rancher) Delete(project, kind, id string) (Resource, error) {
+	return r.Action(project, kind, id, "delete")
+}
+
+// Action runs the action on the resource of the kind with the given ID
+func (r *Rancher) Action(project, kind, id, action string) (Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tick()
+
+	res, err := r.find(project, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := actions[kind][action]
+	if !ok {
+		return nil, invalid("invalid action %v on %v", action, kind)
+	}
+	state := res.str("state")
+	for _, from := range t.from {
+		if state == from {
+			setState(res, t.via)
+			return copyResource(res), nil
+		}
+	}
+	return nil, invalidState(kind, id, action, state)
+}
+
+// Settle runs the pending transitions, and the ones they lead to, to
+// completion
+func (r *Rancher) Settle() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < 10 && r.tick(); i++ {
+	}
+}
+
+// Seed adds a resource of the kind to the project as is, settled in its
+// state or in the one Rancher leads new resources to. Seeding a project
+// or project template ignores the project.
+func (r *Rancher) Seed(project, kind string, v interface{}) (Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := idPrefixes[kind]; !ok {
+		return nil, invalid("unknown kind %v", kind)
+	}
+	res, err := toResource(v)
+	if err != nil {
+		return nil, err
+	}
+	if res.str("state") == "" {
+		res["state"] = initial[kind]
+	}
+	if s, ok := settled[res.str("state")]; ok {
+		res["state"] = s
+	}
+	res = r.add(project, kind, res)
+	r.settle(res)
+	return copyResource(res), nil
+}
+
+func (r *Rancher) add(project, kind string, res Resource) Resource {
+	delete(res, "links")
+	delete(res, "actions")
+	r.counter++
+	res["id"] = fmt.Sprintf("%v%v", idPrefixes[kind], r.counter)
+	res["type"] = kind
+	if res.str("uuid") == "" {
+		res["uuid"] = fmt.Sprintf("fake-uuid-%v", r.counter)
+	}
+	if scoped[kind] {
+		res["accountId"] = project
+	}
+	if kind == HostKind && res.str("hostname") == "" {
+		res["hostname"] = res.str("name")
+	}
+	if kind == HostKind && res.str("name") == "" {
+		res["name"] = res.str("hostname")
+	}
+	setState(res, res.str("state"))
+	r.resources[kind] = append(r.resources[kind], res)
+	return res
+}
+
+// has returns true if there is a resource of the kind with the ID,
+// without running the pending transitions
+func (r *Rancher) has(kind, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.find("", kind, id)
+	return err == nil
+}
+
+func (r *Rancher) visible(project, kind string, res Resource) bool {
+	return project == "" || !scoped[kind] || res.str("accountId") == project
+}
+
+func (r *Rancher) find(project, kind, id string) (Resource, error) {
+	for _, res := range r.resources[kind] {
+		if res.str("id") == id && r.visible(project, kind, res) {
+			return res, nil
+		}
+	}
+	return nil, notFound(kind, id)
+}
+
+func setState(res Resource, state string) {
+	res["state"] = state
+	if _, ok := settled[state]; ok {
+		res["transitioning"] = "yes"
+	} else {
+		res["transitioning"] = "no"
+	}
+}
+
+// tick settles the transitional states, cascades the removals and scales
+// the services. It returns true if anything changed.
+func (r *Rancher) tick() bool {
+	changed := false
+	var removed []Resource
+	for _, kind := range Kinds() {
+		for _, res := range r.resources[kind] {
+			if s, ok := settled[res.str("state")]; ok {
+				setState(res, s)
+				r.settle(res)
+				changed = true
+				if s == "removed" {
+					removed = append(removed, res)
+				}
+			}
+		}
+	}
+
+	for _, res := range removed {
+		id, kind := res.str("id"), res.str("type")
+		for _, dep := range r.resources[ContainerKind] {
+			if kind == HostKind && dep.str("hostId") == id ||
+				kind == ServiceKind && hasString(dep["serviceIds"], id) {
+				changed = r.remove(dep) || changed
+			}
+		}
+		for _, dep := range r.resources[ServiceKind] {
+			if kind == StackKind && dep.str("stackId") == id {
+				changed = r.remove(dep) || changed
+			}
+		}
+		if kind == ProjectKind {
+			for dkind := range scoped {
+				for _, dep := range r.resources[dkind] {
+					if dep.str("accountId") == id {
+						changed = r.remove(dep) || changed
+					}
+				}
+			}
+		}
+	}
+
+	for _, service := range r.resources[ServiceKind] {
+		changed = r.scale(service) || changed
+	}
+	return changed
+}
+
+// remove starts the removal of a resource not already being removed
+func (r *Rancher) remove(res Resource) bool {
+	if isGone(res.str("state")) {
+		return false
+	}
+	setState(res, "removing")
+	return true
+}
+
+// settle updates the fields depending on the state of a resource
+func (r *Rancher) settle(res Resource) {
+	if res.str("type") != ContainerKind {
+		return
+	}
+	switch res.str("state") {
+	case "running":
+		if res.str("healthState") == "" || res.str("healthState") == "initializing" {
+			res["healthState"] = "healthy"
+		}
+	case "starting", "restarting":
+		res["healthState"] = "initializing"
+	}
+}
+
+// scale creates or removes the containers of an active service to match
+// its scale, and updates its current scale and health
+func (r *Rancher) scale(service Resource) bool {
+	if service.str("state") != "active" {
+		return false
+	}
+	id := service.str("id")
+	scale := 0
+	fmt.Sscan(service.str("scale"), &scale)
+
+	var live []Resource
+	running := 0
+	for _, c := range r.resources[ContainerKind] {
+		if hasString(c["serviceIds"], id) && !isGone(c.str("state")) {
+			live = append(live, c)
+			if c.str("state") == "running" && c.str("healthState") == "healthy" {
+				running++
+			}
+		}
+	}
+
+	changed := false
+	for len(live) > scale {
+		r.remove(live[len(live)-1])
+		live = live[:len(live)-1]
+		changed = true
+	}
+	for len(live) < scale {
+		host := r.leastLoadedHost(service.str("accountId"))
+		if host == nil {
+			break
+		}
+		c := Resource{
+			"name":        fmt.Sprintf("%v-%v-%v", r.stackName(service), service.str("name"), r.counter+1),
+			"hostId":      host.str("id"),
+			"stackId":     service.str("stackId"),
+			"serviceIds":  []interface{}{id},
+			"healthState": "initializing",
+			"state":       "starting",
+		}
+		if lc, ok := service["launchConfig"].(map[string]interface{}); ok {
+			if labels, ok := lc["labels"]; ok {
+				c["labels"] = labels
+			}
+			if image, ok := lc["imageUuid"]; ok {
+				c["imageUuid"] = image
+			}
+		}
+		live = append(live, r.add(service.str("accountId"), ContainerKind, copyResource(c)))
+		changed = true
+	}
+
+	var ids []interface{}
+	for _, c := range live {
+		ids = append(ids, c.str("id"))
+	}
+	service["instanceIds"] = ids
+	service["currentScale"] = len(live)
+	health := "healthy"
+	if running < scale {
+		health = "degraded"
+	}
+	if service.str("healthState") != health {
+		service["healthState"] = health
+		changed = true
+	}
+	return changed
+}
+
+func (r *Rancher) stackName(service Resource) string {
+	if stack, err := r.find("", StackKind, service.str("stackId")); err == nil {
+		return stack.str("name")
+	}
+	return "stack"
+}
+
+// leastLoadedHost returns the active host of the project with the fewest
+// containers, nil if there is none
+func (r *Rancher) leastLoadedHost(project string) Resource {
+	var best Resource
+	bestLoad := 0
+	for _, host := range r.resources[HostKind] {
+		if host.str("state") != "active" || host.str("accountId") != project {
+			continue
+		}
+		load := 0
+		for _, c := range r.resources[ContainerKind] {
+			if c.str("hostId") == host.str("id") && !isGone(c.str("state")) {
+				load++
+			}
+		}
+		if best == nil || load < bestLoad {
+			best, bestLoad = host, load
+		}
+	}
+	return best
+}
+
+func isGone(state string) bool {
+	return state == "removing" || state == "removed" || state == "purging" || state == "purged"
+}
+
+func hasString(list interface{}, s string) bool {
+	values, _ := list.([]interface{})
+	for _, v := range values {
+		if fmt.Sprint(v) == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+func seed(t *testing.T, r *Rancher, project, kind string, v interface{}) string {
+	res, err := r.Seed(project, kind, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res["id"].(string)
+}
+
+func state(t *testing.T, r *Rancher, kind, id string) string {
+	res, err := r.Get("", kind, id)
+	if err != nil {
+		t.Fatalf("%v %v not found: %v", kind, id, err)
+	}
+	return res.str("state")
+}
+
+func TestSeed(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	host := seed(t, r, project, HostKind, client.Host{Hostname: "host-a", State: "activating"})
+
+	res, err := r.Get(project, HostKind, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.str("state") != "active" || res.str("name") != "host-a" || res.str("accountId") != project {
+		t.Errorf("seeded host %v", res)
+	}
+	if state(t, r, ProjectKind, project) != "active" {
+		t.Errorf("seeded project is not active")
+	}
+	if _, err := r.Seed(project, "widget", Resource{}); err == nil {
+		t.Errorf("seeding an unknown kind did not fail")
+	}
+}
+
+func TestListScopedByProject(t *testing.T) {
+	r := New()
+	a := seed(t, r, "", ProjectKind, client.Project{Name: "a"})
+	b := seed(t, r, "", ProjectKind, client.Project{Name: "b"})
+	seed(t, r, a, HostKind, client.Host{Name: "host-a", State: "active"})
+	seed(t, r, b, HostKind, client.Host{Name: "host-b", State: "inactive"})
+
+	tests := []struct {
+		project string
+		filters map[string]interface{}
+		want    int
+	}{
+		{a, nil, 1},
+		{b, nil, 1},
+		{"", nil, 2},
+		{"", map[string]interface{}{"state": "active"}, 1},
+		{a, map[string]interface{}{"name_like": "%-b"}, 0},
+	}
+	for _, test := range tests {
+		list, err := r.List(test.project, HostKind, test.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != test.want {
+			t.Errorf("listing the hosts of %q with %v gave %v, expecting %v", test.project, test.filters, len(list), test.want)
+		}
+	}
+
+	// Projects aren't scoped
+	if list, _ := r.List(a, ProjectKind, nil); len(list) != 2 {
+		t.Errorf("listed %v projects from a project, expecting 2", len(list))
+	}
+	// Resources of other projects can't be reached
+	host, _ := r.List(b, HostKind, nil)
+	if _, err := r.Get(a, HostKind, host[0].str("id")); !client.IsNotFound(err) {
+		t.Errorf("getting a host of another project returned %v, expecting not found", err)
+	}
+}
+
+func TestClientList(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	for i := 0; i < DefaultLimit+10; i++ {
+		seed(t, r, project, HostKind, client.Host{Name: "host", State: "active"})
+	}
+
+	c := r.Client(project)
+	collection, err := c.Host.List(&client.ListOpts{Filters: map[string]interface{}{"state": "active"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The in-memory collections come in a single page
+	if len(collection.Data) != DefaultLimit+10 {
+		t.Errorf("listed %v hosts, expecting %v", len(collection.Data), DefaultLimit+10)
+	}
+	next, err := collection.Next()
+	if next != nil || err != nil {
+		t.Errorf("Next returned %v, %v, expecting no page", next, err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	c := r.Client(project)
+
+	host, err := c.Host.Create(&client.Host{Hostname: "cmhost-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.State != "activating" || host.AccountId != project || host.Id == "" {
+		t.Errorf("created host %+v", host)
+	}
+	// The transitional state lasts until the next call
+	if got, _ := c.Host.ById(host.Id); got == nil || got.State != "active" {
+		t.Errorf("created host is %+v, expecting it active", got)
+	}
+
+	tests := []struct {
+		name   string
+		create func() error
+	}{
+		{"host without a name", func() error { _, err := c.Host.Create(&client.Host{}); return err }},
+		{"service without a stack", func() error {
+			_, err := c.Service.Create(&client.Service{Name: "web", StackId: "1st999"})
+			return err
+		}},
+	}
+	for _, test := range tests {
+		if err := test.create(); err == nil {
+			t.Errorf("creating a %v did not fail", test.name)
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	host := seed(t, r, project, HostKind, client.Host{Name: "host-a", State: "active"})
+
+	// An active host must be deactivated before it is deleted
+	if _, err := r.Delete(project, HostKind, host); err == nil {
+		t.Fatalf("deleting an active host did not fail")
+	}
+	if _, err := r.Action(project, HostKind, host, "deactivate"); err != nil {
+		t.Fatal(err)
+	}
+	if s := state(t, r, HostKind, host); s != "inactive" {
+		t.Errorf("deactivated host is %v", s)
+	}
+	if _, err := r.Action(project, HostKind, host, "explode"); err == nil {
+		t.Errorf("an unknown action did not fail")
+	}
+	if _, err := r.Delete(project, HostKind, host); err != nil {
+		t.Fatal(err)
+	}
+	r.Settle()
+	if s := state(t, r, HostKind, host); s != "removed" {
+		t.Errorf("deleted host is %v", s)
+	}
+	if _, err := r.Action(project, HostKind, "1h999", "deactivate"); !client.IsNotFound(err) {
+		t.Errorf("acting on a missing host returned %v, expecting not found", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+
+	updated, err := r.Update("", ProjectKind, project, Resource{"description": "marked", "state": "inactive", "id": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.str("description") != "marked" || updated.str("state") != "active" || updated.str("id") != project {
+		t.Errorf("updated project %v, expecting only the description to change", updated)
+	}
+}
+
+func TestServicesScale(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	seed(t, r, project, HostKind, client.Host{Name: "host-a", State: "active"})
+	seed(t, r, project, HostKind, client.Host{Name: "host-b", State: "active"})
+	c := r.Client(project)
+
+	stack, err := c.Stack.Create(&client.Stack{Name: "cmstack-long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := c.Service.Create(&client.Service{Name: "web", StackId: stack.Id, Scale: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Settle()
+
+	instances, err := c.Service.ListInstances(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances.Data) != 3 {
+		t.Fatalf("service scaled to %v instances, expecting 3", len(instances.Data))
+	}
+	for _, instance := range instances.Data {
+		if instance.State != "running" || instance.HealthState != "healthy" {
+			t.Errorf("instance %v is %v and %v", instance.Name, instance.State, instance.HealthState)
+		}
+	}
+
+	// Removing the stack removes its services and their containers
+	if err := c.Stack.Delete(stack); err != nil {
+		t.Fatal(err)
+	}
+	r.Settle()
+	if s := state(t, r, ServiceKind, service.Id); s != "removed" {
+		t.Errorf("service of the removed stack is %v", s)
+	}
+	for _, instance := range instances.Data {
+		if s := state(t, r, ContainerKind, instance.Id); s != "removed" {
+			t.Errorf("instance %v of the removed service is %v", instance.Name, s)
+		}
+	}
+}
+
+func TestProjectRemoval(t *testing.T) {
+	r := New()
+	project := seed(t, r, "", ProjectKind, client.Project{Name: "chaosmonkey"})
+	host := seed(t, r, project, HostKind, client.Host{Name: "host-a", State: "active"})
+
+	for _, action := range []string{"deactivate", "delete"} {
+		if _, err := r.Action("", ProjectKind, project, action); err != nil {
+			t.Fatalf("%v failed: %v", action, err)
+		}
+		r.Settle()
+	}
+	if s := state(t, r, HostKind, host); s != "removed" {
+		t.Errorf("host of the removed project is %v", s)
+	}
+	if _, err := r.Action("", ProjectKind, project, "purge"); err != nil {
+		t.Fatal(err)
+	}
+	r.Settle()
+	if s := state(t, r, ProjectKind, project); s != "purged" {
+		t.Errorf("purged project is %v", s)
+	}
+}
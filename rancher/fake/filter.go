@@ -0,0 +1,104 @@
+package fake
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// modifiers are the suffixes of the filters Rancher supports, the plain
+// field name being an equality
+var modifiers = []string{"eq", "ne", "neq", "like", "notlike", "prefix", "null", "notnull"}
+
+// Matches returns true if the resource matches all the filters, as Rancher
+// would filter a collection. A filter value may be a list, matching any
+// of its elements.
+func Matches(res Resource, filters map[string]interface{}) bool {
+	for key, value := range filters {
+		field, modifier := splitFilter(key)
+		if !matchFilter(res.str(field), modifier, filterValues(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitFilter(key string) (string, string) {
+	i := strings.LastIndex(key, "_")
+	if i < 0 {
+		return key, "eq"
+	}
+	for _, m := range modifiers {
+		if key[i+1:] == m {
+			return key[:i], m
+		}
+	}
+	return key, "eq"
+}
+
+func filterValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var values []string
+		for _, e := range v {
+			values = append(values, fmt.Sprint(e))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+func matchFilter(actual, modifier string, values []string) bool {
+	switch modifier {
+	case "null":
+		return actual == ""
+	case "notnull":
+		return actual != ""
+	case "ne", "neq", "notlike":
+		for _, v := range values {
+			if matchValue(actual, modifier, v) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if matchValue(actual, modifier, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchValue(actual, modifier, value string) bool {
+	switch modifier {
+	case "like", "notlike":
+		return like(actual, value)
+	case "prefix":
+		return strings.HasPrefix(actual, value)
+	}
+	return actual == value
+}
+
+// like matches as SQL does, with % standing for any text and _ for any
+// character, ignoring the case
+func like(actual, pattern string) bool {
+	var expr []string
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr = append(expr, ".*")
+		case '_':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+	re, err := regexp.Compile("(?is)^" + strings.Join(expr, "") + "$")
+	if err != nil {
+		return false
+	}
+	return re.MatchString(actual)
+}
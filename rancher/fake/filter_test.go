@@ -0,0 +1,34 @@
+package fake
+
+import "testing"
+
+func TestMatches(t *testing.T) {
+	res := Resource{"name": "cmhost-abc", "state": "active", "externalId": "catalog://library:cattle"}
+
+	tests := []struct {
+		filters map[string]interface{}
+		want    bool
+	}{
+		{nil, true},
+		{map[string]interface{}{"name": "cmhost-abc"}, true},
+		{map[string]interface{}{"name_eq": "cmhost-xyz"}, false},
+		{map[string]interface{}{"state_ne": "removed"}, true},
+		{map[string]interface{}{"state_neq": "active"}, false},
+		{map[string]interface{}{"name_like": "CMHOST-%"}, true},
+		{map[string]interface{}{"name_like": "cmhost-a_c"}, true},
+		{map[string]interface{}{"name_like": "%ipsec%"}, false},
+		{map[string]interface{}{"name_notlike": "%ipsec%"}, true},
+		{map[string]interface{}{"name_prefix": "cmhost-"}, true},
+		{map[string]interface{}{"description_null": ""}, true},
+		{map[string]interface{}{"externalId_notnull": ""}, true},
+		{map[string]interface{}{"state": []string{"inactive", "active"}}, true},
+		{map[string]interface{}{"state_ne": []interface{}{"inactive", "active"}}, false},
+		{map[string]interface{}{"name_prefix": "cmhost-", "state": "inactive"}, false},
+	}
+
+	for _, test := range tests {
+		if got := Matches(res, test.filters); got != test.want {
+			t.Errorf("Matches(%v) = %v, expecting %v", test.filters, got, test.want)
+		}
+	}
+}
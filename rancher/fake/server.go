@@ -0,0 +1,381 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+// DefaultLimit is the number of resources in a page of a collection
+const DefaultLimit = 100
+
+// schemaKinds are the schemas served and the kinds of resources they
+// hold, an instance being a container
+var schemaKinds = map[string]string{
+	"host":            HostKind,
+	"instance":        ContainerKind,
+	"container":       ContainerKind,
+	"stack":           StackKind,
+	"service":         ServiceKind,
+	"project":         ProjectKind,
+	"projectTemplate": ProjectTemplateKind,
+	"apiKey":          ApiKeyKind,
+}
+
+// links are the links of the resources of a kind, besides self, and the
+// kinds of the resources they lead to
+var links = map[string]map[string]string{
+	ServiceKind: {"instances": ContainerKind},
+}
+
+// reserved are the query parameters which aren't filters
+var reserved = map[string]bool{"limit": true, "marker": true, "sort": true, "order": true, "action": true}
+
+func plural(schema string) string {
+	return schema + "s"
+}
+
+// Server serves a Rancher over HTTP as the v2-beta API, well enough for
+// the go-rancher client: the schemas of the account and of its projects,
+// the collections with their filters and pages, the resources with their
+// links and actions.
+type Server struct {
+	*httptest.Server
+	Rancher *Rancher
+}
+
+// NewServer starts a Server for the Rancher. Its URL is the one of the
+// Rancher server, without the API version.
+func NewServer(r *Rancher) *Server {
+	s := &Server{Rancher: r}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// request is an API request, split in its scope and its path in the scope
+type request struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	base    string
+	project string
+	path    []string
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if path[0] != "v2-beta" {
+		writeError(w, notFound("path", r.URL.Path))
+		return
+	}
+
+	req := &request{w: w, r: r, base: "http://" + r.Host + "/v2-beta", path: path[1:]}
+	if len(req.path) >= 3 && req.path[0] == "projects" {
+		req.project = req.path[1]
+		req.base += "/projects/" + req.project
+		req.path = req.path[2:]
+	}
+	w.Header().Set("X-API-Schemas", req.base+"/schemas")
+
+	if req.project != "" {
+		if !s.Rancher.has(ProjectKind, req.project) {
+			writeError(w, notFound(ProjectKind, req.project))
+			return
+		}
+	}
+
+	switch {
+	case len(req.path) == 0 || req.path[0] == "":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type":  "apiVersion",
+			"id":    "v2-beta",
+			"links": map[string]string{"self": req.base, "schemas": req.base + "/schemas"},
+		})
+	case req.path[0] == "schemas":
+		s.schemas(req)
+	case len(req.path) == 1:
+		s.collection(req)
+	case len(req.path) == 2:
+		s.resource(req)
+	case len(req.path) == 3:
+		s.link(req)
+	default:
+		writeError(w, notFound("path", r.URL.Path))
+	}
+}
+
+func (s *Server) schemas(req *request) {
+	var names []string
+	for name := range schemaKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data []client.Schema
+	for _, name := range names {
+		kind := schemaKinds[name]
+		resourceActions := map[string]client.Action{}
+		for action := range actions[kind] {
+			if action != "delete" {
+				resourceActions[action] = client.Action{Output: name}
+			}
+		}
+		filters := map[string]client.Filter{}
+		for _, field := range []string{"id", "name", "state", "uuid", "accountId", "externalId", "hostId", "stackId", "kind"} {
+			filters[field] = client.Filter{Modifiers: modifiers}
+		}
+		data = append(data, client.Schema{
+			Resource: client.Resource{
+				Id:   name,
+				Type: "schema",
+				Links: map[string]string{
+					"self":       req.base + "/schemas/" + name,
+					"collection": req.base + "/" + plural(name),
+				},
+			},
+			PluralName:        plural(name),
+			ResourceMethods:   []string{"GET", "PUT", "DELETE"},
+			ResourceActions:   resourceActions,
+			CollectionMethods: []string{"GET", "POST"},
+			CollectionFilters: filters,
+		})
+	}
+
+	if len(req.path) == 2 {
+		for _, schema := range data {
+			if schema.Id == req.path[1] {
+				writeJSON(req.w, http.StatusOK, schema)
+				return
+			}
+		}
+		writeError(req.w, notFound("schema", req.path[1]))
+		return
+	}
+	writeJSON(req.w, http.StatusOK, map[string]interface{}{
+		"type":         "collection",
+		"resourceType": "schema",
+		"links":        map[string]string{"self": req.base + "/schemas"},
+		"data":         data,
+	})
+}
+
+// kind returns the schema and the kind of the resources of a collection
+func (req *request) kind() (string, string, error) {
+	for name, kind := range schemaKinds {
+		if plural(name) == req.path[0] {
+			return name, kind, nil
+		}
+	}
+	return "", "", notFound("collection", req.path[0])
+}
+
+func (s *Server) collection(req *request) {
+	schema, kind, err := req.kind()
+	if err != nil {
+		writeError(req.w, err)
+		return
+	}
+
+	switch req.r.Method {
+	case "GET":
+		list, err := s.Rancher.List(req.project, kind, filters(req.r.URL.Query()))
+		if err != nil {
+			writeError(req.w, err)
+			return
+		}
+		s.writeCollection(req, schema, req.base+"/"+plural(schema), list)
+	case "POST":
+		fields := Resource{}
+		if err := json.NewDecoder(req.r.Body).Decode(&fields); err != nil {
+			writeError(req.w, invalid("invalid %v: %v", schema, err))
+			return
+		}
+		created, err := s.Rancher.Create(req.project, kind, fields)
+		if err != nil {
+			writeError(req.w, err)
+			return
+		}
+		writeJSON(req.w, http.StatusCreated, decorate(req.base, schema, created))
+	default:
+		writeError(req.w, notAllowed(req.r.Method))
+	}
+}
+
+func (s *Server) resource(req *request) {
+	schema, kind, err := req.kind()
+	if err != nil {
+		writeError(req.w, err)
+		return
+	}
+	id := req.path[1]
+
+	var res Resource
+	switch req.r.Method {
+	case "GET":
+		res, err = s.Rancher.Get(req.project, kind, id)
+	case "PUT":
+		updates := Resource{}
+		if err := json.NewDecoder(req.r.Body).Decode(&updates); err != nil {
+			writeError(req.w, invalid("invalid %v: %v", schema, err))
+			return
+		}
+		res, err = s.Rancher.Update(req.project, kind, id, updates)
+	case "DELETE":
+		res, err = s.Rancher.Delete(req.project, kind, id)
+	case "POST":
+		action := req.r.URL.Query().Get("action")
+		if action == "" {
+			writeError(req.w, notAllowed(req.r.Method))
+			return
+		}
+		res, err = s.Rancher.Action(req.project, kind, id, action)
+	default:
+		writeError(req.w, notAllowed(req.r.Method))
+		return
+	}
+	if err != nil {
+		writeError(req.w, err)
+		return
+	}
+	writeJSON(req.w, http.StatusOK, decorate(req.base, schema, res))
+}
+
+func (s *Server) link(req *request) {
+	schema, kind, err := req.kind()
+	if err != nil {
+		writeError(req.w, err)
+		return
+	}
+	id, link := req.path[1], req.path[2]
+	target, ok := links[kind][link]
+	if !ok || req.r.Method != "GET" {
+		writeError(req.w, notFound("link", link))
+		return
+	}
+	if _, err := s.Rancher.Get(req.project, kind, id); err != nil {
+		writeError(req.w, err)
+		return
+	}
+
+	list, err := s.Rancher.List(req.project, target, filters(req.r.URL.Query()))
+	if err != nil {
+		writeError(req.w, err)
+		return
+	}
+	var linked []Resource
+	for _, res := range list {
+		if hasString(res["serviceIds"], id) {
+			linked = append(linked, res)
+		}
+	}
+	self := req.base + "/" + plural(schema) + "/" + id + "/" + link
+	s.writeCollection(req, target, self, linked)
+}
+
+// writeCollection writes the page of the list starting at the marker of
+// the request
+func (s *Server) writeCollection(req *request, schema, self string, list []Resource) {
+	query := req.r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = DefaultLimit
+	}
+	start := 0
+	if marker := query.Get("marker"); marker != "" {
+		start, _ = strconv.Atoi(strings.TrimPrefix(marker, "m"))
+	}
+	if start < 0 || start > len(list) {
+		start = len(list)
+	}
+	end := start + limit
+	if end > len(list) {
+		end = len(list)
+	}
+
+	data := []Resource{}
+	for _, res := range list[start:end] {
+		data = append(data, decorate(req.base, schema, res))
+	}
+	limit64, total := int64(limit), int64(len(list))
+	pagination := &client.Pagination{Limit: &limit64, Total: &total}
+	if end < len(list) {
+		query.Set("marker", fmt.Sprintf("m%v", end))
+		pagination.Next = self + "?" + query.Encode()
+		pagination.Partial = true
+	}
+	writeJSON(req.w, http.StatusOK, map[string]interface{}{
+		"type":         "collection",
+		"resourceType": schema,
+		"links":        map[string]string{"self": self},
+		"pagination":   pagination,
+		"data":         data,
+	})
+}
+
+// decorate adds the links and actions of the resource, under the
+// collection of the schema
+func decorate(base, schema string, res Resource) Resource {
+	self := base + "/" + plural(schema) + "/" + res.str("id")
+	resLinks := map[string]interface{}{"self": self}
+	for link := range links[schemaKinds[schema]] {
+		resLinks[link] = self + "/" + link
+	}
+	res["links"] = resLinks
+
+	resActions := map[string]interface{}{}
+	for _, action := range Actions(schemaKinds[schema], res) {
+		resActions[action] = self + "?action=" + action
+	}
+	res["actions"] = resActions
+	return res
+}
+
+// filters returns the filters of a query, a filter given more than once
+// matching any of its values
+func filters(query url.Values) map[string]interface{} {
+	f := map[string]interface{}{}
+	for key, values := range query {
+		if reserved[key] {
+			continue
+		}
+		if len(values) == 1 {
+			f[key] = values[0]
+		} else {
+			f[key] = values
+		}
+	}
+	return f
+}
+
+func notAllowed(method string) error {
+	return &client.ApiError{
+		StatusCode: http.StatusMethodNotAllowed,
+		Status:     "405 Method Not Allowed",
+		Msg:        fmt.Sprintf("method %v not allowed", method),
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if apiErr, ok := err.(*client.ApiError); ok {
+		status = apiErr.StatusCode
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"type":    "error",
+		"status":  status,
+		"code":    http.StatusText(status),
+		"message": err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
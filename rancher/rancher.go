@@ -0,0 +1,120 @@
+package rancher
+
+import (
+	"github.com/rancher/go-rancher/v2"
+)
+
+// Hosts are the operations on hosts used by the chaos monkey
+type Hosts interface {
+	List(opts *client.ListOpts) (*client.HostCollection, error)
+	Create(host *client.Host) (*client.Host, error)
+	ById(id string) (*client.Host, error)
+	Update(existing *client.Host, updates interface{}) (*client.Host, error)
+	Delete(host *client.Host) error
+	ActionDeactivate(host *client.Host) (*client.Host, error)
+}
+
+// Instances are the operations on instances used by the chaos monkey
+type Instances interface {
+	List(opts *client.ListOpts) (*client.InstanceCollection, error)
+	ById(id string) (*client.Instance, error)
+	ActionRestart(instance *client.Instance) (*client.Instance, error)
+	ActionRemove(instance *client.Instance) (*client.Instance, error)
+	ActionStart(instance *client.Instance) (*client.Instance, error)
+}
+
+// Containers are the operations on containers, the instances with labels
+// and a service, used by the chaos monkey
+type Containers interface {
+	ById(id string) (*client.Container, error)
+}
+
+// Stacks are the operations on stacks used by the chaos monkey
+type Stacks interface {
+	List(opts *client.ListOpts) (*client.StackCollection, error)
+	Create(stack *client.Stack) (*client.Stack, error)
+	ById(id string) (*client.Stack, error)
+	Update(existing *client.Stack, updates interface{}) (*client.Stack, error)
+	Delete(stack *client.Stack) error
+}
+
+// Services are the operations on services used by the chaos monkey
+type Services interface {
+	List(opts *client.ListOpts) (*client.ServiceCollection, error)
+	Create(service *client.Service) (*client.Service, error)
+	ById(id string) (*client.Service, error)
+	Update(existing *client.Service, updates interface{}) (*client.Service, error)
+	Delete(service *client.Service) error
+	// ListInstances lists the containers of the service
+	ListInstances(service *client.Service) (*client.ContainerCollection, error)
+}
+
+// Projects are the operations on projects used by the chaos monkey
+type Projects interface {
+	List(opts *client.ListOpts) (*client.ProjectCollection, error)
+	Create(project *client.Project) (*client.Project, error)
+	ById(id string) (*client.Project, error)
+	Update(existing *client.Project, updates interface{}) (*client.Project, error)
+	Delete(project *client.Project) error
+	ActionDeactivate(project *client.Project) (*client.Account, error)
+	ActionPurge(project *client.Project) (*client.Account, error)
+}
+
+// ProjectTemplates are the operations on project templates used by the
+// chaos monkey
+type ProjectTemplates interface {
+	List(opts *client.ListOpts) (*client.ProjectTemplateCollection, error)
+}
+
+// ApiKeys are the operations on API keys used by the chaos monkey
+type ApiKeys interface {
+	Create(key *client.ApiKey) (*client.ApiKey, error)
+}
+
+// Client is the part of the Rancher API used by the chaos monkey. The
+// resources are scoped to a project, except the projects and their
+// templates which are scoped to the account.
+type Client struct {
+	Host            Hosts
+	Instance        Instances
+	Container       Containers
+	Stack           Stacks
+	Service         Services
+	Project         Projects
+	ProjectTemplate ProjectTemplates
+	ApiKey          ApiKeys
+
+	// API is the client of a real Rancher server, nil when faked. The
+	// docker proxies need it.
+	API *client.RancherClient
+}
+
+// services adds the listing of the instances of a service, which is
+// reached through a link
+type services struct {
+	client.ServiceOperations
+	base client.RancherBaseClient
+}
+
+func (s *services) ListInstances(service *client.Service) (*client.ContainerCollection, error) {
+	containers := &client.ContainerCollection{}
+	if err := s.base.GetLink(service.Resource, "instances", containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// New returns the Client using the given client of a Rancher server
+func New(c *client.RancherClient) *Client {
+	return &Client{
+		Host:            c.Host,
+		Instance:        c.Instance,
+		Container:       c.Container,
+		Stack:           c.Stack,
+		Service:         &services{c.Service, c.RancherBaseClient},
+		Project:         c.Project,
+		ProjectTemplate: c.ProjectTemplate,
+		ApiKey:          c.ApiKey,
+		API:             c,
+	}
+}
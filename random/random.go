@@ -0,0 +1,197 @@
+package random
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// KindSeed is the kind of the decision recording the seed of a run
+const KindSeed = "seed"
+
+// Decision is a single random choice made during a run
+type Decision struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Choice     string    `json:"choice"`
+	Candidates int       `json:"candidates,omitempty"`
+}
+
+// Source is the per-run source of randomness. Every decision made through
+// it is written to the journal, if one is set, and when replaying, the
+// decisions are taken from the replayed journal instead.
+//
+// Decisions are matched by kind and by the identity of the choice rather
+// than its position, so a replay picks the same scenarios and targets even
+// if the order of the candidates differs. When a recorded choice is no
+// longer a candidate, a random choice is made instead.
+type Source struct {
+	mu      sync.Mutex
+	rand    *rand.Rand
+	journal *json.Encoder
+	replay  map[string][]string
+}
+
+// New returns a Source seeded with the given seed
+func New(seed int64) *Source {
+	return &Source{
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// SetJournal makes the source write every decision, starting with the
+// given seed, as a line of JSON to w
+func (s *Source) SetJournal(w io.Writer, seed int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journal = json.NewEncoder(w)
+	return s.journal.Encode(Decision{
+		Time:   time.Now().UTC(),
+		Kind:   KindSeed,
+		Choice: strconv.FormatInt(seed, 10),
+	})
+}
+
+// LoadReplay reads the decisions of a journal to be repeated. If the
+// journal recorded a seed, the source is reseeded with it and the seed is
+// returned, otherwise 0.
+func (s *Source) LoadReplay(r io.Reader) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seed int64
+	replay := map[string][]string{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var d Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return 0, fmt.Errorf("invalid decision at line %v: %v", line, err)
+		}
+		if d.Kind == KindSeed {
+			var err error
+			if seed, err = strconv.ParseInt(d.Choice, 10, 64); err != nil {
+				return 0, fmt.Errorf("invalid seed at line %v: %v", line, err)
+			}
+			continue
+		}
+		replay[d.Kind] = append(replay[d.Kind], d.Choice)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if seed != 0 {
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+	s.replay = replay
+	return seed, nil
+}
+
+// nextReplay returns the next recorded choice of the given kind
+func (s *Source) nextReplay(kind string) (string, bool) {
+	choices := s.replay[kind]
+	if len(choices) == 0 {
+		return "", false
+	}
+	s.replay[kind] = choices[1:]
+	return choices[0], true
+}
+
+func (s *Source) record(kind, choice string, candidates int) {
+	if s.journal == nil {
+		return
+	}
+	err := s.journal.Encode(Decision{
+		Time:       time.Now().UTC(),
+		Kind:       kind,
+		Choice:     choice,
+		Candidates: candidates,
+	})
+	if err != nil {
+		logrus.Errorf("error journaling decision %v: %v", kind, err)
+	}
+}
+
+// Choose picks one of the candidates, identified by their names, and
+// returns its index. If weights is not nil, the probability of a
+// candidate being picked is proportional to its weight.
+func (s *Source) Choose(kind string, candidates []string, weights []int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(candidates) == 0 {
+		panic("random: no candidates to choose from")
+	}
+
+	if choice, ok := s.nextReplay(kind); ok {
+		for i, c := range candidates {
+			if c == choice {
+				s.record(kind, choice, len(candidates))
+				return i
+			}
+		}
+		logrus.Warnf("replay: %v %v is no longer a candidate, choosing at random", kind, choice)
+	}
+
+	index := len(candidates) - 1
+	if weights == nil {
+		index = s.rand.Intn(len(candidates))
+	} else {
+		total := 0
+		for _, w := range weights {
+			total += w
+		}
+		pick := s.rand.Intn(total)
+		for i, w := range weights {
+			if pick -= w; pick < 0 {
+				index = i
+				break
+			}
+		}
+	}
+
+	s.record(kind, candidates[index], len(candidates))
+	return index
+}
+
+// Intn returns a number in [0, n)
+func (s *Source) Intn(kind string, n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if choice, ok := s.nextReplay(kind); ok {
+		if i, err := strconv.Atoi(choice); err == nil && i >= 0 && i < n {
+			s.record(kind, choice, n)
+			return i
+		}
+		logrus.Warnf("replay: %v %v is out of range [0, %v), choosing at random", kind, choice, n)
+	}
+
+	i := s.rand.Intn(n)
+	s.record(kind, strconv.Itoa(i), n)
+	return i
+}
+
+// Token returns a random hex string of 16 characters
+func (s *Source) Token(kind string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if choice, ok := s.nextReplay(kind); ok {
+		s.record(kind, choice, 0)
+		return choice
+	}
+
+	b := make([]byte, 8)
+	s.rand.Read(b)
+	token := fmt.Sprintf("%x", b)
+	s.record(kind, token, 0)
+	return token
+}
@@ -0,0 +1,108 @@
+package random
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSameSeedSameChoices(t *testing.T) {
+	candidates := []string{"a", "b", "c", "d"}
+	s1, s2 := New(42), New(42)
+	for i := 0; i < 20; i++ {
+		if c1, c2 := s1.Choose("x", candidates, nil), s2.Choose("x", candidates, nil); c1 != c2 {
+			t.Fatalf("choice %v differs with the same seed: %v and %v", i, c1, c2)
+		}
+	}
+}
+
+func TestChooseWeights(t *testing.T) {
+	s := New(1)
+	for i := 0; i < 100; i++ {
+		if got := s.Choose("x", []string{"a", "b", "c"}, []int{0, 1, 0}); got != 1 {
+			t.Fatalf("Choose picked %v, the only candidate with a weight is 1", got)
+		}
+	}
+}
+
+func TestJournal(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(7)
+	if err := s.SetJournal(&buf, 7); err != nil {
+		t.Fatalf("SetJournal failed: %v", err)
+	}
+	s.Choose("scenario", []string{"a", "b"}, nil)
+	s.Intn("wait", 10)
+	s.Token("name")
+
+	var kinds []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var d Decision
+		if err := dec.Decode(&d); err != nil {
+			t.Fatalf("invalid decision: %v", err)
+		}
+		kinds = append(kinds, d.Kind)
+	}
+	want := []string{KindSeed, "scenario", "wait", "name"}
+	if len(kinds) != len(want) {
+		t.Fatalf("journaled %v, expecting %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("journaled %v, expecting %v", kinds, want)
+			break
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(3)
+	s.SetJournal(&buf, 3)
+	choice := s.Choose("scenario", []string{"a", "b", "c"}, nil)
+	n := s.Intn("wait", 100)
+	token := s.Token("name")
+
+	r := New(99)
+	seed, err := r.LoadReplay(&buf)
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+	if seed != 3 {
+		t.Errorf("LoadReplay returned seed %v, expecting 3", seed)
+	}
+
+	// The same candidate is picked even if it moved
+	reordered := []string{"c", "b", "a"}
+	want := []string{"a", "b", "c"}[choice]
+	if got := r.Choose("scenario", reordered, nil); reordered[got] != want {
+		t.Errorf("replay chose %v, expecting %v", reordered[got], want)
+	}
+	if got := r.Intn("wait", 100); got != n {
+		t.Errorf("replay returned %v, expecting %v", got, n)
+	}
+	if got := r.Token("name"); got != token {
+		t.Errorf("replay returned token %v, expecting %v", got, token)
+	}
+}
+
+func TestReplayMissingCandidate(t *testing.T) {
+	journal := `{"kind":"scenario","choice":"gone"}` + "\n" + `{"kind":"wait","choice":"50"}` + "\n"
+	s := New(1)
+	if _, err := s.LoadReplay(bytes.NewBufferString(journal)); err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+	if got := s.Choose("scenario", []string{"a"}, nil); got != 0 {
+		t.Errorf("Choose returned %v out of a single candidate", got)
+	}
+	if got := s.Intn("wait", 10); got < 0 || got >= 10 {
+		t.Errorf("Intn returned %v, out of [0, 10)", got)
+	}
+}
+
+func TestLoadReplayInvalid(t *testing.T) {
+	if _, err := New(1).LoadReplay(bytes.NewBufferString("not json\n")); err == nil {
+		t.Errorf("loading an invalid journal did not fail")
+	}
+}
@@ -1,28 +1,204 @@
 package scenarios
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/Sirupsen/logrus"
-	"github.com/leodotcloud/chaos-monkey/scenarios/dns"
-	"github.com/leodotcloud/chaos-monkey/scenarios/host"
-	"github.com/leodotcloud/chaos-monkey/scenarios/ipsec"
-	"github.com/leodotcloud/chaos-monkey/scenarios/metadata"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/selector"
 	"github.com/leodotcloud/chaos-monkey/types"
+
+	// The built-in scenarios register themselves
+	_ "github.com/leodotcloud/chaos-monkey/scenarios/dns"
+	_ "github.com/leodotcloud/chaos-monkey/scenarios/host"
+	_ "github.com/leodotcloud/chaos-monkey/scenarios/ipsec"
+	_ "github.com/leodotcloud/chaos-monkey/scenarios/metadata"
 )
 
-// GetScenarios collectes all the various scenarios available
-func GetScenarios() []types.Scenario {
+// Filter selects which of the registered scenarios are run
+type Filter struct {
+	// Enable lists the IDs of scenarios to run, even if they are disabled
+	// by default
+	Enable []string
+	// Disable lists the IDs of scenarios not to run
+	Disable []string
+	// Tags restricts the scenarios to the ones having any of the tags
+	Tags []string
+	// Overrides tune the defaults of the scenarios, by ID
+	Overrides map[string]Override
+}
+
+// Override tunes the defaults of a scenario, zero values keep the defaults
+type Override struct {
+	Weight        int
+	VerifyTimeout time.Duration
+	Cooldown      time.Duration
+	MaxPerHour    int
+	Params        types.Params
+	// Targets replace the default include rules of the scenario, if any
+	// are given, and add to its exclude rules
+	Targets selector.Selector
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEnabled returns true if the filter selects the scenario
+func (f *Filter) IsEnabled(r *registry.Registration) bool {
+	if contains(f.Disable, r.ID) {
+		return false
+	}
+	if contains(f.Enable, r.ID) {
+		return true
+	}
+	if r.Disabled {
+		return false
+	}
+	return len(f.Tags) == 0 || r.HasTag(f.Tags...)
+}
+
+// Validate checks that the scenarios and params referred to by the filter
+// exist, and that the values of the params have the types of the defaults
+func (f *Filter) Validate() error {
+	for _, id := range append(append([]string{}, f.Enable...), f.Disable...) {
+		if _, ok := registry.Get(id); !ok {
+			return fmt.Errorf("unknown scenario: %v", id)
+		}
+	}
+	for id, o := range f.Overrides {
+		r, ok := registry.Get(id)
+		if !ok {
+			return fmt.Errorf("unknown scenario: %v", id)
+		}
+		for key, value := range o.Params {
+			def, ok := r.Params[key]
+			if !ok {
+				return fmt.Errorf("unknown param %v for scenario %v, known params: %v",
+					key, id, paramKeys(r.Params))
+			}
+			if err := checkParamType(def, value); err != nil {
+				return fmt.Errorf("invalid value %q for param %v of scenario %v: %v", value, key, id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkParamType checks that the value of a param has the type of its
+// default: an int or a duration if the default is one
+func checkParamType(def, value string) error {
+	if _, err := strconv.Atoi(def); err == nil {
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("expecting an int like the default %v", def)
+		}
+		return nil
+	}
+	if _, err := time.ParseDuration(def); err == nil {
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("expecting a duration like the default %v", def)
+		}
+	}
+	return nil
+}
+
+func paramKeys(params types.Params) []string {
+	keys := []string{}
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// base returns the base of the registered scenario with the overrides of
+// the filter applied
+func (f *Filter) base(r *registry.Registration) types.BaseScenario {
+	o := f.Overrides[r.ID]
+	base := r.Base(o.Params, o.Targets)
+	if o.Weight > 0 {
+		base.Weight = o.Weight
+	}
+	if o.VerifyTimeout > 0 {
+		base.VerifyTimeout = o.VerifyTimeout
+	}
+	if o.Cooldown > 0 {
+		base.Cooldown = o.Cooldown
+	}
+	if o.MaxPerHour > 0 {
+		base.MaxPerHour = o.MaxPerHour
+	}
+	return base
+}
+
+// GetScenarios collectes the registered scenarios selected by the filter
+func GetScenarios(f Filter) ([]types.Scenario, error) {
 	logrus.Debugf("collecting scenarios")
-	scenarios := []types.Scenario{
-		&host.AddHostUsingAPI{types.BaseScenario{Skip: false, Name: "Add a Host using Rancher API"}},
-		&host.DeleteHostUsingAPI{types.BaseScenario{Skip: false, Name: "Delete a Host using Rancher API"}},
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
 
-		&dns.ReloadOneRandomDNSContainerUsingAPI{types.BaseScenario{Skip: false, Name: "Reload a random DNS container using API"}},
+	var scenarios []types.Scenario
+	for _, r := range registry.List() {
+		if !f.IsEnabled(&r) {
+			logrus.Debugf("scenario %v is not enabled", r.ID)
+			continue
+		}
+		scenarios = append(scenarios, r.New(f.base(&r)))
+	}
 
-		&metadata.ReloadOneRandomMetadataContainerUsingAPI{types.BaseScenario{Skip: true, Name: "Reload a random Metadata container using API"}},
+	return scenarios, nil
+}
 
-		&ipsec.ReloadOneRandomIPSecContainerUsingAPI{types.BaseScenario{Skip: false, Name: "Reload a random IPSec router container using API"}},
-		&ipsec.RemoveOneRandomIPSecContainerUsingDocker{types.BaseScenario{Skip: false, Name: "Remove a random IPSec router container using Docker"}},
+// Info describes a registered scenario, as tuned by a filter
+type Info struct {
+	ID            string
+	Description   string
+	Tags          []string
+	Enabled       bool
+	Weight        int
+	VerifyTimeout time.Duration
+	Cooldown      time.Duration
+	MaxPerHour    int
+	Params        types.Params
+	Targets       selector.Selector
+}
+
+// List describes all the registered scenarios, as tuned by the filter
+func List(f Filter) []Info {
+	var infos []Info
+	for _, r := range registry.List() {
+		base := f.base(&r)
+		infos = append(infos, Info{
+			ID:            r.ID,
+			Description:   r.Description,
+			Tags:          r.Tags,
+			Enabled:       f.IsEnabled(&r),
+			Weight:        base.GetWeight(),
+			VerifyTimeout: base.GetVerifyTimeout(),
+			Cooldown:      base.GetCooldown(),
+			MaxPerHour:    base.GetMaxPerHour(),
+			Params:        base.Params,
+			Targets:       base.Targets,
+		})
 	}
+	return infos
+}
 
-	return scenarios
+// New returns the registered scenario with the given ID, as tuned by the
+// filter, whether the filter enables it or not
+func New(id string, f Filter) (types.Scenario, error) {
+	r, ok := registry.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown scenario: %v", id)
+	}
+	return r.New(f.base(&r)), nil
 }
@@ -1,18 +1,33 @@
 package dns
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
 	"github.com/leodotcloud/chaos-monkey/types"
 	//"github.com/rancher/go-rancher/v2"
 )
 
+func init() {
+	registry.Register(registry.Registration{
+		ID:          "reload-dns-api",
+		Description: "Reload a random DNS container using API",
+		Tags:        []string{"dns", "api"},
+		Weight:      4,
+		Disabled:    true,
+		New: func(b types.BaseScenario) types.Scenario {
+			return &ReloadOneRandomDNSContainerUsingAPI{b}
+		},
+	})
+}
+
 // ReloadOneRandomDNSContainerUsingAPI ...
 type ReloadOneRandomDNSContainerUsingAPI struct{ types.BaseScenario }
 
 // Run ...
-func (s *ReloadOneRandomDNSContainerUsingAPI) Run(si *types.SharedInfo) error {
+func (s *ReloadOneRandomDNSContainerUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
 	return fmt.Errorf("Not implemented")
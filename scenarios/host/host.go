@@ -1,28 +1,157 @@
 package host
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
 	"github.com/leodotcloud/chaos-monkey/types"
 	"github.com/leodotcloud/chaos-monkey/utils"
-	//"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/go-rancher/v2"
 )
 
+func init() {
+	registry.Register(registry.Registration{
+		ID:            "add-host-api",
+		Description:   "Add a Host using Rancher API",
+		Tags:          []string{"host", "api"},
+		Weight:        1,
+		VerifyTimeout: 15 * time.Minute,
+		Params:        types.Params{"count": "1"},
+		New: func(b types.BaseScenario) types.Scenario {
+			return &AddHostUsingAPI{b}
+		},
+	})
+	registry.Register(registry.Registration{
+		ID:            "delete-host-api",
+		Description:   "Delete a Host using Rancher API",
+		Tags:          []string{"host", "api", "destructive"},
+		Weight:        1,
+		VerifyTimeout: 15 * time.Minute,
+		Params:        types.Params{"count": "1"},
+		New: func(b types.BaseScenario) types.Scenario {
+			return &DeleteHostUsingAPI{b}
+		},
+	})
+}
+
 // AddHostUsingAPI ...
 type AddHostUsingAPI struct{ types.BaseScenario }
 
 // DeleteHostUsingAPI ...
 type DeleteHostUsingAPI struct{ types.BaseScenario }
 
+func addHostTargets(ex *types.Execution, hosts []client.Host) {
+	for i := range hosts {
+		ex.AddTarget(utils.HostTarget(&hosts[i]))
+	}
+}
+
+// IsEligible ...
+func (s *AddHostUsingAPI) IsEligible(si *types.SharedInfo) (bool, string) {
+	if si.DisableAddHostScenario {
+		return false, "adding of hosts is disabled"
+	}
+	return s.BaseScenario.IsEligible(si)
+}
+
+// Precondition ...
+func (s *AddHostUsingAPI) Precondition(ctx context.Context, si *types.SharedInfo) error {
+	return utils.CheckHostsConverged(ctx, si)
+}
+
 // Run ...
-func (s *AddHostUsingAPI) Run(si *types.SharedInfo) error {
+func (s *AddHostUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
-	return utils.AddHostsUsingAPI(si, 1, si.MaxClusterSize)
+	hosts, err := utils.AddHostsUsingAPI(ctx, si, s.Params.Int("count", 1), si.MaxClusterSize)
+	addHostTargets(ex, hosts)
+	return err
+}
+
+// Verify checks that the added hosts became active
+func (s *AddHostUsingAPI) Verify(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	for _, target := range ex.TargetsOfKind("host") {
+		host, err := si.Client.Host.ById(target.ID)
+		if err != nil {
+			return err
+		}
+		if host == nil {
+			return fmt.Errorf("host %v not found", target.Name)
+		}
+		if host.State != "active" {
+			return fmt.Errorf("host %v is in state %v", host.Name, host.State)
+		}
+	}
+	return utils.CheckHostsConverged(ctx, si)
+}
+
+// Rollback deletes the hosts which were added
+func (s *AddHostUsingAPI) Rollback(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	var lastErr error
+	for _, target := range ex.TargetsOfKind("host") {
+		host, err := si.Client.Host.ById(target.ID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if host == nil || utils.IsHostGone(host) {
+			continue
+		}
+		logrus.Infof("rolling back: deleting host %v", host.Name)
+		if err := utils.DeleteHost(ctx, si, host); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// IsEligible ...
+func (s *DeleteHostUsingAPI) IsEligible(si *types.SharedInfo) (bool, string) {
+	if si.DisableDelHostScenario {
+		return false, "deleting of hosts is disabled"
+	}
+	return s.BaseScenario.IsEligible(si)
+}
+
+// Precondition ...
+func (s *DeleteHostUsingAPI) Precondition(ctx context.Context, si *types.SharedInfo) error {
+	return utils.CheckHostsConverged(ctx, si)
 }
 
 // Run ...
-func (s *DeleteHostUsingAPI) Run(si *types.SharedInfo) error {
+func (s *DeleteHostUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
-	return utils.DeleteHostsUsingAPI(si, 1)
+	hosts, err := utils.DeleteHostsUsingAPI(ctx, si, s.Targets, s.Params.Int("count", 1))
+	addHostTargets(ex, hosts)
+	return err
+}
+
+// Verify checks that the deleted hosts are gone and the rest of the hosts
+// are active
+func (s *DeleteHostUsingAPI) Verify(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	for _, target := range ex.TargetsOfKind("host") {
+		host, err := si.Client.Host.ById(target.ID)
+		if err != nil {
+			return err
+		}
+		if host != nil && !utils.IsHostGone(host) {
+			return fmt.Errorf("host %v is still in state %v", host.Name, host.State)
+		}
+	}
+	return utils.CheckHostsConverged(ctx, si)
+}
+
+// Rollback adds back as many hosts as were deleted
+func (s *DeleteHostUsingAPI) Rollback(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	deleted := len(ex.TargetsOfKind("host"))
+	if deleted == 0 {
+		return nil
+	}
+	logrus.Infof("rolling back: adding %v hosts", deleted)
+	_, err := utils.AddHostsUsingAPI(ctx, si, deleted, si.MaxClusterSize)
+	return err
 }
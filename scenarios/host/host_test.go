@@ -0,0 +1,231 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/leodotcloud/chaos-monkey/blast"
+	"github.com/leodotcloud/chaos-monkey/rancher/fake"
+	"github.com/leodotcloud/chaos-monkey/random"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// cluster seeds a project with hosts in the given states, owned by the
+// chaos monkey unless foreign, and returns the shared info reaching it
+func cluster(t *testing.T, states []string, foreign int) (*fake.Rancher, *types.SharedInfo) {
+	r := fake.New()
+	project, err := r.Seed("", fake.ProjectKind, client.Project{Name: "chaosmonkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectID := project["id"].(string)
+
+	owned := map[string]interface{}{
+		utils.InstanceLabel: utils.DefaultInstanceID,
+		utils.EnabledLabel:  "true",
+	}
+	for i, state := range states {
+		host := client.Host{Name: fmt.Sprintf("cmhost-%v", i), State: state, Labels: owned}
+		if _, err := r.Seed(projectID, fake.HostKind, host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < foreign; i++ {
+		host := client.Host{Name: fmt.Sprintf("other-%v", i), State: "active"}
+		if _, err := r.Seed(projectID, fake.HostKind, host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return r, &types.SharedInfo{
+		Client:     r.Client(projectID),
+		InstanceID: utils.DefaultInstanceID,
+		Campaign:   "test",
+		Random:     random.New(1),
+	}
+}
+
+func newScenario(t *testing.T, id string, count string) types.Scenario {
+	reg, ok := registry.Get(id)
+	if !ok {
+		t.Fatalf("scenario %v is not registered", id)
+	}
+	return reg.New(reg.Base(types.Params{"count": count}, selector.Selector{}))
+}
+
+func countHosts(t *testing.T, si *types.SharedInfo, state string) int {
+	hosts, err := utils.ListOwnedHosts(context.Background(), si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, host := range hosts {
+		if host.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDeleteHost(t *testing.T) {
+	active := []string{"active", "active", "active"}
+	tests := []struct {
+		name    string
+		states  []string
+		foreign int
+		claimed int
+		min     int
+		count   string
+		deleted int
+		fails   bool
+	}{
+		{name: "above the minimum", states: active, min: 2, count: "1", deleted: 1},
+		{name: "capped by the minimum", states: active, min: 2, count: "2", deleted: 1},
+		{name: "at the minimum", states: active, min: 3, count: "1", deleted: 0},
+		{name: "below the minimum", states: active, min: 4, count: "1", fails: true},
+		{name: "inactive hosts don't count", states: []string{"active", "active", "inactive"}, min: 2, count: "1", deleted: 0},
+		{name: "foreign hosts don't count", states: []string{"active", "active"}, foreign: 2, min: 2, count: "1", deleted: 0},
+		{name: "claimed hosts don't count", states: active, claimed: 1, min: 3, count: "1", fails: true},
+		{name: "no hosts", min: 0, count: "1", fails: true},
+	}
+
+	for _, test := range tests {
+		r, si := cluster(t, test.states, test.foreign)
+		si.MinClusterSize = test.min
+		si.BlastRadius = blast.New(blast.Budget{})
+		hosts, err := utils.ListOwnedHosts(context.Background(), si)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < test.claimed; i++ {
+			si.BlastRadius.Claim("other", blast.Target{Host: hosts[i].Id})
+		}
+
+		s := newScenario(t, "delete-host-api", test.count)
+		ex := types.NewExecution(s.GetID())
+		err = s.Run(types.WithExecution(context.Background(), ex), si, ex)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%v: Run did not fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: Run failed: %v", test.name, err)
+			continue
+		}
+		if got := len(ex.TargetsOfKind("host")); got != test.deleted {
+			t.Errorf("%v: deleted %v hosts, expecting %v", test.name, got, test.deleted)
+		}
+
+		r.Settle()
+		if got := countHosts(t, si, "removed"); got != test.deleted {
+			t.Errorf("%v: %v hosts removed, expecting %v", test.name, got, test.deleted)
+		}
+		if err := s.(types.Verifier).Verify(context.Background(), si, ex); test.deleted > 0 && err != nil {
+			t.Errorf("%v: Verify failed: %v", test.name, err)
+		}
+	}
+}
+
+func TestDeleteHostRollback(t *testing.T) {
+	r, si := cluster(t, []string{"active", "active", "active"}, 0)
+	si.MinClusterSize = 1
+	si.MaxClusterSize = 3
+
+	s := newScenario(t, "delete-host-api", "2")
+	ex := types.NewExecution(s.GetID())
+	ctx := types.WithExecution(context.Background(), ex)
+	if err := s.Run(ctx, si, ex); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	r.Settle()
+	if err := s.(types.RollBacker).Rollback(ctx, si, ex); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	r.Settle()
+	if got := countHosts(t, si, "active"); got != 3 {
+		t.Errorf("%v hosts active after the rollback, expecting 3", got)
+	}
+}
+
+func TestAddHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		max    int
+		count  string
+		added  int
+		fails  bool
+	}{
+		{name: "below the maximum", states: []string{"active", "active"}, max: 3, count: "1", added: 1},
+		{name: "capped by the maximum", states: []string{"active", "active"}, max: 3, count: "2", added: 1},
+		{name: "up to the maximum", states: []string{"active"}, max: 3, count: "0", added: 2},
+		{name: "above the maximum", states: []string{"active", "active", "active", "active"}, max: 3, count: "1", fails: true},
+		{name: "removed hosts don't count", states: []string{"active", "active", "removed"}, max: 3, count: "1", added: 1},
+	}
+
+	for _, test := range tests {
+		r, si := cluster(t, test.states, 0)
+		si.MaxClusterSize = test.max
+
+		s := newScenario(t, "add-host-api", test.count)
+		ex := types.NewExecution(s.GetID())
+		err := s.Run(types.WithExecution(context.Background(), ex), si, ex)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%v: Run did not fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: Run failed: %v", test.name, err)
+			continue
+		}
+		if got := len(ex.TargetsOfKind("host")); got != test.added {
+			t.Errorf("%v: added %v hosts, expecting %v", test.name, got, test.added)
+		}
+		if got := len(ex.Actions); got != test.added {
+			t.Errorf("%v: recorded %v actions, expecting %v", test.name, got, test.added)
+		}
+
+		r.Settle()
+		if err := s.(types.Verifier).Verify(context.Background(), si, ex); err != nil {
+			t.Errorf("%v: Verify failed: %v", test.name, err)
+		}
+	}
+}
+
+func TestAddHostDryRun(t *testing.T) {
+	r, si := cluster(t, []string{"active"}, 0)
+	si.MaxClusterSize = 3
+	si.DryRun = true
+
+	s := newScenario(t, "add-host-api", "1")
+	ex := types.NewExecution(s.GetID())
+	if err := s.Run(types.WithExecution(context.Background(), ex), si, ex); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	r.Settle()
+	if got := countHosts(t, si, "active"); got != 1 {
+		t.Errorf("%v hosts after a dry run, expecting 1", got)
+	}
+	if len(ex.Actions) != 0 {
+		t.Errorf("a dry run recorded actions: %v", ex.Actions)
+	}
+}
+
+func TestEligible(t *testing.T) {
+	si := &types.SharedInfo{DisableAddHostScenario: true}
+	if ok, _ := newScenario(t, "add-host-api", "1").IsEligible(si); ok {
+		t.Errorf("add-host-api is eligible while adding hosts is disabled")
+	}
+	if ok, _ := newScenario(t, "delete-host-api", "1").IsEligible(si); !ok {
+		t.Errorf("delete-host-api is not eligible while only adding hosts is disabled")
+	}
+}
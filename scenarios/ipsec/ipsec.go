@@ -1,88 +1,242 @@
 package ipsec
 
 import (
-	//"fmt"
+	"context"
+	"fmt"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/selector"
 	"github.com/leodotcloud/chaos-monkey/types"
 	"github.com/leodotcloud/chaos-monkey/utils"
 	"github.com/rancher/go-rancher/v2"
 )
 
-// ReloadOneRandomIPSecContainerUsingAPI ...
-type ReloadOneRandomIPSecContainerUsingAPI struct{ types.BaseScenario }
+// defaultNameLike matches the names of the ipsec router containers
+const defaultNameLike = "%ipsec-router%"
 
-// Run ...
-func (s *ReloadOneRandomIPSecContainerUsingAPI) Run(si *types.SharedInfo) error {
-	logrus.Debugf("Running Scenario: %v", s.Name)
+// defaultTargets are the running routers, the other ones being already
+// down
+var defaultTargets = selector.Selector{
+	Include: selector.Rules{{States: []string{"running"}}},
+}
 
-	// TODO: state: running
+func init() {
+	registry.Register(registry.Registration{
+		ID:          "reload-ipsec-api",
+		Description: "Reload a random IPSec router container using API",
+		Tags:        []string{"ipsec", "network", "api"},
+		Weight:      4,
+		Params:      types.Params{"name_like": defaultNameLike},
+		Targets:     defaultTargets,
+		New: func(b types.BaseScenario) types.Scenario {
+			return &ReloadOneRandomIPSecContainerUsingAPI{b}
+		},
+	})
+	registry.Register(registry.Registration{
+		ID:          "remove-ipsec-api",
+		Description: "Remove a random IPSec router container using API",
+		Tags:        []string{"ipsec", "network", "api"},
+		Weight:      2,
+		Disabled:    true,
+		Params:      types.Params{"name_like": defaultNameLike},
+		Targets:     defaultTargets,
+		New: func(b types.BaseScenario) types.Scenario {
+			return &RemoveOneRandomIPSecContainerUsingAPI{b}
+		},
+	})
+	registry.Register(registry.Registration{
+		ID:          "remove-ipsec-docker",
+		Description: "Remove a random IPSec router container using Docker",
+		Tags:        []string{"ipsec", "network", "docker"},
+		Weight:      2,
+		Params:      types.Params{"name_like": defaultNameLike},
+		Targets:     defaultTargets,
+		New: func(b types.BaseScenario) types.Scenario {
+			return &RemoveOneRandomIPSecContainerUsingDocker{b}
+		},
+	})
+}
+
+// listIPSecRouters lists the instances whose names are like the name_like
+// param, the selectors of the scenario then narrow them down
+func listIPSecRouters(ctx context.Context, si *types.SharedInfo, params types.Params) ([]client.Instance, error) {
 	instanceListOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
-			"name" + "_like": "%ipsec-router%",
+			"name" + "_like": params.String("name_like", defaultNameLike),
 		},
 	}
 	instanceCollection, err := si.Client.Instance.List(instanceListOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []client.Instance
+	for instanceCollection != nil {
+		instances = append(instances, instanceCollection.Data...)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		instanceCollection, err = instanceCollection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+// checkIPSecRoutersConverged returns an error unless there is a running
+// ipsec router on every active host
+func checkIPSecRoutersConverged(ctx context.Context, si *types.SharedInfo, params types.Params) error {
+	routers, err := listIPSecRouters(ctx, si, params)
+	if err != nil {
+		return err
+	}
+
+	running := 0
+	for _, router := range routers {
+		if router.State == "running" {
+			running++
+		}
+	}
+
+	hostListOpts := &client.ListOpts{
+		Filters: map[string]interface{}{
+			"state_eq": "active",
+		},
+	}
+	hosts, err := utils.ListHosts(ctx, si, hostListOpts)
+	if err != nil {
+		return err
+	}
+
+	if running != len(hosts) {
+		return fmt.Errorf("%v ipsec routers running for %v active hosts",
+			running, len(hosts))
+	}
+	return nil
+}
+
+// ReloadOneRandomIPSecContainerUsingAPI ...
+type ReloadOneRandomIPSecContainerUsingAPI struct{ types.BaseScenario }
+
+// Precondition ...
+func (s *ReloadOneRandomIPSecContainerUsingAPI) Precondition(ctx context.Context, si *types.SharedInfo) error {
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
+
+// Run ...
+func (s *ReloadOneRandomIPSecContainerUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	logrus.Debugf("Running Scenario: %v", s.Name)
+
+	routers, err := listIPSecRouters(ctx, si, s.Params)
 	if err != nil {
 		return err
 	}
 
-	err = utils.ReloadRandomInstanceUsingAPI(si.Client, instanceCollection.Data)
+	instance, err := utils.ReloadRandomInstanceUsingAPI(ctx, si, s.Targets, routers)
 	if err != nil {
 		return err
 	}
+	ex.AddTarget(utils.InstanceTarget(instance))
 
 	return nil
 }
 
+// Verify checks that the reloaded router is running again and that
+// every active host has a running ipsec router
+func (s *ReloadOneRandomIPSecContainerUsingAPI) Verify(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	for _, target := range ex.TargetsOfKind("instance") {
+		instance, err := si.Client.Instance.ById(target.ID)
+		if err != nil {
+			return err
+		}
+		if instance == nil {
+			return fmt.Errorf("instance %v not found", target.Name)
+		}
+		if err := utils.CheckInstancesRunning([]client.Instance{*instance}); err != nil {
+			return err
+		}
+	}
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
+
+// Rollback starts the reloaded router if it didn't come back up
+func (s *ReloadOneRandomIPSecContainerUsingAPI) Rollback(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	for _, target := range ex.TargetsOfKind("instance") {
+		instance, err := si.Client.Instance.ById(target.ID)
+		if err != nil {
+			return err
+		}
+		if instance == nil || instance.State != "stopped" {
+			continue
+		}
+		logrus.Infof("rolling back: starting instance %v", instance.Name)
+		if err := utils.StartInstance(ctx, si, instance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RemoveOneRandomIPSecContainerUsingAPI ...
 type RemoveOneRandomIPSecContainerUsingAPI struct{ types.BaseScenario }
 
+// Precondition ...
+func (s *RemoveOneRandomIPSecContainerUsingAPI) Precondition(ctx context.Context, si *types.SharedInfo) error {
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
+
 // Run ...
-func (s *RemoveOneRandomIPSecContainerUsingAPI) Run(si *types.SharedInfo) error {
+func (s *RemoveOneRandomIPSecContainerUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
-	// TODO: state: running
-	instanceListOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name" + "_like": "%ipsec-router%",
-		},
-	}
-	instanceCollection, err := si.Client.Instance.List(instanceListOpts)
+	routers, err := listIPSecRouters(ctx, si, s.Params)
 	if err != nil {
 		return err
 	}
 
-	err = utils.RemoveRandomInstanceUsingAPI(si.Client, instanceCollection.Data)
+	instance, err := utils.RemoveRandomInstanceUsingAPI(ctx, si, s.Targets, routers)
 	if err != nil {
 		return err
 	}
+	ex.AddTarget(utils.InstanceTarget(instance))
 
 	return nil
 }
 
+// Verify checks that Rancher replaced the removed router
+func (s *RemoveOneRandomIPSecContainerUsingAPI) Verify(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
+
 // RemoveOneRandomIPSecContainerUsingDocker ...
 type RemoveOneRandomIPSecContainerUsingDocker struct{ types.BaseScenario }
 
+// Precondition ...
+func (s *RemoveOneRandomIPSecContainerUsingDocker) Precondition(ctx context.Context, si *types.SharedInfo) error {
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
+
 // Run ...
-func (s *RemoveOneRandomIPSecContainerUsingDocker) Run(si *types.SharedInfo) error {
+func (s *RemoveOneRandomIPSecContainerUsingDocker) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
-	// TODO: state: running
-	instanceListOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name" + "_like": "%ipsec-router%",
-		},
-	}
-	instanceCollection, err := si.Client.Instance.List(instanceListOpts)
+	routers, err := listIPSecRouters(ctx, si, s.Params)
 	if err != nil {
 		return err
 	}
 
-	err = utils.RemoveRandomInstanceUsingDocker(si, instanceCollection.Data)
+	instance, err := utils.RemoveRandomInstanceUsingDocker(ctx, si, s.Targets, routers)
 	if err != nil {
 		return err
 	}
+	ex.AddTarget(utils.InstanceTarget(instance))
 
 	return nil
 }
+
+// Verify checks that Rancher replaced the removed router
+func (s *RemoveOneRandomIPSecContainerUsingDocker) Verify(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
+	return checkIPSecRoutersConverged(ctx, si, s.Params)
+}
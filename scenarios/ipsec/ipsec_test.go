@@ -0,0 +1,186 @@
+package ipsec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	dockerfake "github.com/leodotcloud/chaos-monkey/docker/fake"
+	"github.com/leodotcloud/chaos-monkey/rancher/fake"
+	"github.com/leodotcloud/chaos-monkey/random"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/leodotcloud/chaos-monkey/utils"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// router is an ipsec router container, on a host of its own
+type router struct {
+	state  string
+	labels map[string]interface{}
+}
+
+// routers seeds a project with the routers, running in the docker
+// daemons of their hosts, and returns the IDs of their docker containers
+// along with the daemons
+func routers(t *testing.T, e *dockerfake.Executor, specs []router) (*types.SharedInfo, []string, []*dockerfake.Daemon) {
+	r := fake.New()
+	project, err := r.Seed("", fake.ProjectKind, client.Project{Name: "chaosmonkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectID := project["id"].(string)
+
+	var ids []string
+	var daemons []*dockerfake.Daemon
+	for i, spec := range specs {
+		host, err := r.Seed(projectID, fake.HostKind, client.Host{Name: fmt.Sprintf("host-%v", i), State: "active"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hostID := host["id"].(string)
+		d, err := e.Daemon(hostID)
+		if err != nil {
+			t.Fatalf("error starting the docker daemon of host %v: %v", hostID, err)
+		}
+		name := fmt.Sprintf("ipsec-ipsec-router-%v", i)
+		id := d.AddContainer(dockerfake.Container{Name: name})
+		_, err = r.Seed(projectID, fake.ContainerKind, client.Container{
+			Name:       name,
+			State:      spec.state,
+			HostId:     hostID,
+			ExternalId: id,
+			Labels:     spec.labels,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		daemons = append(daemons, d)
+	}
+
+	return &types.SharedInfo{
+		Client: r.Client(projectID),
+		Random: random.New(1),
+		Docker: e,
+	}, ids, daemons
+}
+
+func newScenario(t *testing.T, id string) types.Scenario {
+	reg, ok := registry.Get(id)
+	if !ok {
+		t.Fatalf("scenario %v is not registered", id)
+	}
+	return reg.New(reg.Base(nil, selector.Selector{}))
+}
+
+func TestRemoveUsingDocker(t *testing.T) {
+	excluded := map[string]interface{}{utils.ExcludeLabel: "true"}
+
+	tests := []struct {
+		name    string
+		routers []router
+		dryRun  bool
+		// removed is the index of the router expected to be removed, -1
+		// for none
+		removed int
+		err     string
+	}{
+		{name: "removes the router", routers: []router{{state: "running"}}, removed: 0},
+		{name: "skips the stopped routers", routers: []router{{state: "stopped"}, {state: "running"}}, removed: 1},
+		{name: "skips the excluded routers", routers: []router{{state: "running", labels: excluded}, {state: "running"}}, removed: 1},
+		{name: "no router to remove", routers: []router{{state: "stopped"}}, removed: -1, err: "no instances available"},
+		{name: "dry-run", routers: []router{{state: "running"}}, dryRun: true, removed: -1},
+	}
+
+	for _, test := range tests {
+		e := dockerfake.NewExecutor()
+		si, ids, daemons := routers(t, e, test.routers)
+		si.DryRun = test.dryRun
+
+		s := newScenario(t, "remove-ipsec-docker")
+		ex := types.NewExecution(s.GetID())
+		err := s.Run(types.WithExecution(context.Background(), ex), si, ex)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: Run returned %v, expecting an error about %v", test.name, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("%v: Run failed: %v", test.name, err)
+		}
+
+		for i, id := range ids {
+			_, exists := daemons[i].Container(id)
+			calls := daemons[i].CallsTo(id)
+			if i == test.removed {
+				if exists {
+					t.Errorf("%v: container %v was not removed", test.name, id)
+				}
+				if len(calls) != 1 || calls[0].Op != "remove" || calls[0].Query["force"] != "1" {
+					t.Errorf("%v: expecting a forced removal of container %v, got %+v", test.name, id, calls)
+				}
+			} else {
+				if !exists || len(calls) > 0 {
+					t.Errorf("%v: container %v was hit: %+v", test.name, id, calls)
+				}
+			}
+		}
+
+		actions := 0
+		if test.removed >= 0 {
+			actions = 1
+			if len(ex.Actions) == 1 && ex.Actions[0].Verb != "docker-remove" {
+				t.Errorf("%v: recorded %v, expecting docker-remove", test.name, ex.Actions[0].Verb)
+			}
+		}
+		if len(ex.Actions) != actions {
+			t.Errorf("%v: recorded %v actions, expecting %v", test.name, len(ex.Actions), actions)
+		}
+		e.Shutdown()
+	}
+}
+
+func TestRoutersConvergedPages(t *testing.T) {
+	s := fake.NewServer(fake.New())
+	defer s.Close()
+	project, err := s.Rancher.Seed("", fake.ProjectKind, client.Project{Name: "chaosmonkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectID := project["id"].(string)
+
+	hosts := fake.DefaultLimit + 5
+	for i := 0; i < hosts; i++ {
+		host, err := s.Rancher.Seed(projectID, fake.HostKind, client.Host{Name: fmt.Sprintf("host-%v", i), State: "active"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Rancher.Seed(projectID, fake.ContainerKind, client.Container{
+			Name:   fmt.Sprintf("ipsec-ipsec-router-%v", i),
+			State:  "running",
+			HostId: host["id"].(string),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := utils.GetClientForProject(context.Background(), s.URL, projectID, "", "")
+	if err != nil {
+		t.Fatalf("error connecting to project %v: %v", projectID, err)
+	}
+	si := &types.SharedInfo{Client: c}
+
+	if err := checkIPSecRoutersConverged(context.Background(), si, nil); err != nil {
+		t.Errorf("%v routers on %v hosts are not converged: %v", hosts, hosts, err)
+	}
+
+	if _, err := s.Rancher.Seed(projectID, fake.HostKind, client.Host{Name: "host-new", State: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPSecRoutersConverged(context.Background(), si, nil); err == nil {
+		t.Errorf("%v routers on %v hosts are converged", hosts, hosts+1)
+	}
+}
@@ -1,18 +1,33 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/scenarios/registry"
 	"github.com/leodotcloud/chaos-monkey/types"
 	//"github.com/rancher/go-rancher/v2"
 )
 
+func init() {
+	registry.Register(registry.Registration{
+		ID:          "reload-metadata-api",
+		Description: "Reload a random Metadata container using API",
+		Tags:        []string{"metadata", "api"},
+		Weight:      4,
+		Disabled:    true,
+		New: func(b types.BaseScenario) types.Scenario {
+			return &ReloadOneRandomMetadataContainerUsingAPI{b}
+		},
+	})
+}
+
 // ReloadOneRandomMetadataContainerUsingAPI ...
 type ReloadOneRandomMetadataContainerUsingAPI struct{ types.BaseScenario }
 
 // Run ...
-func (s *ReloadOneRandomMetadataContainerUsingAPI) Run(si *types.SharedInfo) error {
+func (s *ReloadOneRandomMetadataContainerUsingAPI) Run(ctx context.Context, si *types.SharedInfo, ex *types.Execution) error {
 	logrus.Debugf("Running Scenario: %v", s.Name)
 
 	return fmt.Errorf("Not implemented")
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+// Registration describes a scenario available to the chaos monkey
+type Registration struct {
+	// ID uniquely identifies the scenario
+	ID          string
+	Description string
+	Tags        []string
+	// Weight is the default weight of the scenario
+	Weight int
+	// VerifyTimeout is the default verification timeout of the scenario
+	VerifyTimeout time.Duration
+	// Disabled scenarios only run when explicitly enabled
+	Disabled bool
+	// Params are the default parameters of the scenario
+	Params types.Params
+	// Targets are the default targets of the scenario
+	Targets selector.Selector
+	// Cooldown and MaxPerHour are the default limits on how often the
+	// scenario runs
+	Cooldown   time.Duration
+	MaxPerHour int
+	// New returns the scenario built on the given base
+	New func(types.BaseScenario) types.Scenario
+}
+
+// HasTag returns true if the scenario is tagged with any of the tags
+func (r *Registration) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		for _, t := range r.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Base returns the base of the scenario with its defaults, overridden by
+// the given params and targets
+func (r *Registration) Base(params types.Params, targets selector.Selector) types.BaseScenario {
+	return types.BaseScenario{
+		ID:            r.ID,
+		Name:          r.Description,
+		Weight:        r.Weight,
+		VerifyTimeout: r.VerifyTimeout,
+		Tags:          r.Tags,
+		Params:        r.Params.Merge(params),
+		Targets:       r.Targets.Merge(targets),
+		Cooldown:      r.Cooldown,
+		MaxPerHour:    r.MaxPerHour,
+	}
+}
+
+var (
+	mu            sync.RWMutex
+	registrations = map[string]Registration{}
+)
+
+// Register makes a scenario available. It is meant to be called from the
+// init function of the package implementing the scenario, and panics if
+// the registration is invalid or its ID is already taken.
+func Register(r Registration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if r.ID == "" {
+		panic("registry: scenario registered without an ID")
+	}
+	if r.New == nil {
+		panic(fmt.Sprintf("registry: scenario %v registered without New", r.ID))
+	}
+	if _, ok := registrations[r.ID]; ok {
+		panic(fmt.Sprintf("registry: scenario %v registered twice", r.ID))
+	}
+	registrations[r.ID] = r
+}
+
+// Get returns the registration of the scenario with the given ID
+func Get(id string) (Registration, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	r, ok := registrations[id]
+	return r, ok
+}
+
+// List returns all the registrations, sorted by ID
+func List() []Registration {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var ids []string
+	for id := range registrations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	list := make([]Registration, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, registrations[id])
+	}
+	return list
+}
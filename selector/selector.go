@@ -0,0 +1,235 @@
+package selector
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Candidate is a possible target, as seen by the rules
+type Candidate struct {
+	// Kind is "instance" or "host"
+	Kind    string
+	Name    string
+	State   string
+	Stack   string
+	Service string
+	// Labels are the labels of the container, or of the host
+	Labels map[string]string
+	// ServiceLabels are the labels of the launch config of the service of
+	// the container
+	ServiceLabels map[string]string
+	// Host and HostLabels are the name and the labels of the host of the
+	// container, or of the host itself
+	Host       string
+	HostLabels map[string]string
+}
+
+// Rule matches the candidates meeting all of its conditions. Names and
+// label values are shell patterns, as in path.Match, and an empty
+// condition is always met.
+type Rule struct {
+	Name       string
+	Stack      string
+	Service    string
+	Host       string
+	States     []string
+	Labels     map[string]string
+	HostLabels map[string]string
+}
+
+// ParseRule parses a rule written as comma separated conditions, e.g.
+// stack=web,service=db*,state=running|stopped,label.tier=front,host-label.zone=a
+func ParseRule(s string) (Rule, error) {
+	r := Rule{}
+	if strings.TrimSpace(s) == "" {
+		return r, fmt.Errorf("empty rule")
+	}
+
+	for _, cond := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(cond), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return r, fmt.Errorf("invalid condition %q in rule %q, expecting key=value", cond, s)
+		}
+		key, value := parts[0], parts[1]
+		if _, err := path.Match(value, ""); err != nil {
+			return r, fmt.Errorf("invalid pattern %q in rule %q: %v", value, s, err)
+		}
+
+		switch {
+		case key == "name":
+			r.Name = value
+		case key == "stack":
+			r.Stack = value
+		case key == "service":
+			r.Service = value
+		case key == "host":
+			r.Host = value
+		case key == "state":
+			r.States = strings.Split(value, "|")
+		case strings.HasPrefix(key, "label."):
+			if r.Labels == nil {
+				r.Labels = map[string]string{}
+			}
+			r.Labels[strings.TrimPrefix(key, "label.")] = value
+		case strings.HasPrefix(key, "host-label."):
+			if r.HostLabels == nil {
+				r.HostLabels = map[string]string{}
+			}
+			r.HostLabels[strings.TrimPrefix(key, "host-label.")] = value
+		default:
+			return r, fmt.Errorf("unknown key %q in rule %q, expecting name, stack, service, host, state, label.<key> or host-label.<key>", key, s)
+		}
+	}
+	return r, nil
+}
+
+// String returns the rule in the form parsed by ParseRule
+func (r Rule) String() string {
+	var conds []string
+	add := func(key, value string) {
+		if value != "" {
+			conds = append(conds, key+"="+value)
+		}
+	}
+	add("name", r.Name)
+	add("stack", r.Stack)
+	add("service", r.Service)
+	add("host", r.Host)
+	add("state", strings.Join(r.States, "|"))
+	for _, k := range sortedKeys(r.Labels) {
+		add("label."+k, r.Labels[k])
+	}
+	for _, k := range sortedKeys(r.HostLabels) {
+		add("host-label."+k, r.HostLabels[k])
+	}
+	return strings.Join(conds, ",")
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func match(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+func matchLabels(patterns, labels map[string]string) bool {
+	for k, pattern := range patterns {
+		value, ok := labels[k]
+		if !ok || !match(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the candidate meets all the conditions of the
+// rule
+func (r Rule) Matches(c *Candidate) bool {
+	if !match(r.Name, c.Name) || !match(r.Stack, c.Stack) ||
+		!match(r.Service, c.Service) || !match(r.Host, c.Host) {
+		return false
+	}
+	if len(r.States) > 0 {
+		found := false
+		for _, state := range r.States {
+			if state == c.State {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matchLabels(r.Labels, c.Labels) && matchLabels(r.HostLabels, c.HostLabels)
+}
+
+// Rules is a list of rules
+type Rules []Rule
+
+// ParseRules parses each of the rules
+func ParseRules(rules []string) (Rules, error) {
+	var result Rules
+	for _, s := range rules {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// Match returns the first rule matching the candidate
+func (rs Rules) Match(c *Candidate) (Rule, bool) {
+	for _, r := range rs {
+		if r.Matches(c) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Selector selects the targets of a scenario
+type Selector struct {
+	// Include, if not empty, restricts the targets to the candidates
+	// matching any of the rules
+	Include Rules
+	// Exclude protects the candidates matching any of the rules
+	Exclude Rules
+}
+
+// Select returns whether the candidate is selected, and if not, why
+func (s Selector) Select(c *Candidate) (bool, string) {
+	if r, ok := s.Exclude.Match(c); ok {
+		return false, fmt.Sprintf("excluded by rule %v", r)
+	}
+	if len(s.Include) == 0 {
+		return true, ""
+	}
+	if _, ok := s.Include.Match(c); ok {
+		return true, ""
+	}
+	return false, "not matching any include rule"
+}
+
+// Merge returns the selector with the rules of the override: its include
+// rules replace the ones of the selector, if any, and its exclude rules
+// are added
+func (s Selector) Merge(override Selector) Selector {
+	merged := Selector{
+		Include: s.Include,
+		Exclude: append(append(Rules{}, s.Exclude...), override.Exclude...),
+	}
+	if len(override.Include) > 0 {
+		merged.Include = override.Include
+	}
+	return merged
+}
+
+// UnmarshalYAML parses the rule from a string, in the form parsed by
+// ParseRule
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
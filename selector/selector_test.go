@@ -0,0 +1,159 @@
+package selector
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		invalid bool
+	}{
+		{rule: "stack=web", want: "stack=web"},
+		{rule: "service=db*, state=running|stopped", want: "service=db*,state=running|stopped"},
+		{rule: "host-label.zone=a,label.tier=front,name=x", want: "name=x,label.tier=front,host-label.zone=a"},
+		{rule: "", invalid: true},
+		{rule: "stack", invalid: true},
+		{rule: "=web", invalid: true},
+		{rule: "color=red", invalid: true},
+		{rule: "name=[", invalid: true},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRule(test.rule)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("ParseRule(%q) = %v, expecting an error", test.rule, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRule(%q) failed: %v", test.rule, err)
+			continue
+		}
+		if got := r.String(); got != test.want {
+			t.Errorf("ParseRule(%q) = %v, expecting %v", test.rule, got, test.want)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	c := &Candidate{
+		Kind:       "instance",
+		Name:       "web-1",
+		State:      "running",
+		Stack:      "prod-web",
+		Service:    "web",
+		Labels:     map[string]string{"tier": "front"},
+		Host:       "host-a",
+		HostLabels: map[string]string{"zone": "a"},
+	}
+
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"name=web-*", true},
+		{"name=db-*", false},
+		{"stack=prod*,service=web", true},
+		{"stack=prod*,service=db", false},
+		{"state=stopped|running", true},
+		{"state=stopped", false},
+		{"label.tier=f*", true},
+		{"label.tier=back", false},
+		{"label.missing=*", false},
+		{"host=host-a,host-label.zone=a", true},
+		{"host-label.zone=b", false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRule(test.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) failed: %v", test.rule, err)
+		}
+		if got := r.Matches(c); got != test.want {
+			t.Errorf("%v matches %v = %v, expecting %v", test.rule, c.Name, got, test.want)
+		}
+	}
+}
+
+func mustParseRules(t *testing.T, rules ...string) Rules {
+	rs, err := ParseRules(rules)
+	if err != nil {
+		t.Fatalf("ParseRules(%q) failed: %v", rules, err)
+	}
+	return rs
+}
+
+func TestSelect(t *testing.T) {
+	web := &Candidate{Name: "web-1", Stack: "web"}
+	db := &Candidate{Name: "db-1", Stack: "db"}
+
+	tests := []struct {
+		name      string
+		selector  Selector
+		candidate *Candidate
+		want      bool
+	}{
+		{"no rules", Selector{}, web, true},
+		{"included", Selector{Include: mustParseRules(t, "stack=web")}, web, true},
+		{"not included", Selector{Include: mustParseRules(t, "stack=web")}, db, false},
+		{"excluded", Selector{Exclude: mustParseRules(t, "name=web-*")}, web, false},
+		{
+			"excluded over included",
+			Selector{Include: mustParseRules(t, "stack=web"), Exclude: mustParseRules(t, "name=web-1")},
+			web,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		ok, reason := test.selector.Select(test.candidate)
+		if ok != test.want {
+			t.Errorf("%v: Select(%v) = %v, expecting %v", test.name, test.candidate.Name, ok, test.want)
+		}
+		if !ok && reason == "" {
+			t.Errorf("%v: Select(%v) gave no reason", test.name, test.candidate.Name)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Selector{
+		Include: mustParseRules(t, "stack=web"),
+		Exclude: mustParseRules(t, "name=web-1"),
+	}
+
+	merged := base.Merge(Selector{Exclude: mustParseRules(t, "name=web-2")})
+	if len(merged.Include) != 1 || merged.Include[0].Stack != "web" {
+		t.Errorf("include rules of %v were not kept: %v", base, merged.Include)
+	}
+	if len(merged.Exclude) != 2 {
+		t.Errorf("exclude rules were not added: %v", merged.Exclude)
+	}
+	if len(base.Exclude) != 1 {
+		t.Errorf("merging changed the exclude rules of the selector: %v", base.Exclude)
+	}
+
+	merged = base.Merge(Selector{Include: mustParseRules(t, "stack=db")})
+	if len(merged.Include) != 1 || merged.Include[0].Stack != "db" {
+		t.Errorf("include rules were not replaced: %v", merged.Include)
+	}
+}
+
+func TestUnmarshalYAML(t *testing.T) {
+	var s Selector
+	if err := yaml.Unmarshal([]byte("include: [\"stack=web,state=running\"]\n"), &s); err != nil {
+		t.Fatalf("error unmarshalling: %v", err)
+	}
+	if len(s.Include) != 1 || s.Include[0].String() != "stack=web,state=running" {
+		t.Errorf("unexpected include rules: %v", s.Include)
+	}
+
+	if err := yaml.Unmarshal([]byte("include: [\"color=red\"]\n"), &s); err == nil {
+		t.Errorf("unmarshalling an invalid rule did not fail")
+	}
+}
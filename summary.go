@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/types"
+)
+
+// summary keeps count of the outcomes of the scenarios executed in a run
+type summary struct {
+	run          int
+	succeeded    int
+	failed       int
+	skipped      int
+	verifyFailed int
+	rolledBack   int
+}
+
+func (s *summary) add(ex *types.Execution) {
+	s.run++
+	switch {
+	case ex.Skipped():
+		s.skipped++
+	case ex.Succeeded():
+		s.succeeded++
+	default:
+		s.failed++
+	}
+	if p := ex.GetPhase(types.PhaseVerify); p != nil && p.Err != nil {
+		s.verifyFailed++
+	}
+	if ex.GetPhase(types.PhaseRollback) != nil {
+		s.rolledBack++
+	}
+}
+
+func (s *summary) log() {
+	logrus.Infof("summary: %v scenarios run, %v succeeded, %v failed, %v skipped, %v failed verification, %v rolled back",
+		s.run, s.succeeded, s.failed, s.skipped, s.verifyFailed, s.rolledBack)
+}
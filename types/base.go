@@ -1,9 +1,39 @@
 package types
 
+import (
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/selector"
+)
+
+const (
+	// DefaultScenarioWeight is used for scenarios which don't specify a weight
+	DefaultScenarioWeight = 1
+	// DefaultVerifyTimeout is used for scenarios which don't specify a
+	// verification timeout
+	DefaultVerifyTimeout = 5 * time.Minute
+)
+
 // BaseScenario ...
 type BaseScenario struct {
-	Name string
-	Skip bool
+	ID            string
+	Name          string
+	Skip          bool
+	Weight        int
+	VerifyTimeout time.Duration
+	Tags          []string
+	Params        Params
+	// Targets restricts the resources the scenario acts on
+	Targets selector.Selector
+	// Cooldown is the minimum time between two runs of the scenario, and
+	// MaxPerHour the most runs within an hour, zero disabling the limits
+	Cooldown   time.Duration
+	MaxPerHour int
+}
+
+// GetID returns the unique identifier of the Scenario
+func (bs *BaseScenario) GetID() string {
+	return bs.ID
 }
 
 // GetName returns the name of the Scenario
@@ -15,3 +45,39 @@ func (bs *BaseScenario) GetName() string {
 func (bs *BaseScenario) IsSkip() bool {
 	return bs.Skip
 }
+
+// GetWeight returns the weight of the Scenario, falling back to
+// DefaultScenarioWeight when none is set
+func (bs *BaseScenario) GetWeight() int {
+	if bs.Weight <= 0 {
+		return DefaultScenarioWeight
+	}
+	return bs.Weight
+}
+
+// GetVerifyTimeout returns how long to wait for the cluster to recover,
+// falling back to DefaultVerifyTimeout when none is set
+func (bs *BaseScenario) GetVerifyTimeout() time.Duration {
+	if bs.VerifyTimeout <= 0 {
+		return DefaultVerifyTimeout
+	}
+	return bs.VerifyTimeout
+}
+
+// GetCooldown returns the minimum time between two runs of the scenario
+func (bs *BaseScenario) GetCooldown() time.Duration {
+	return bs.Cooldown
+}
+
+// GetMaxPerHour returns the most runs of the scenario within an hour
+func (bs *BaseScenario) GetMaxPerHour() int {
+	return bs.MaxPerHour
+}
+
+// IsEligible ...
+func (bs *BaseScenario) IsEligible(si *SharedInfo) (bool, string) {
+	if bs.Skip {
+		return false, "marked to be skipped"
+	}
+	return true, ""
+}
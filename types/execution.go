@@ -0,0 +1,149 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// Phases of a scenario execution
+const (
+	PhasePrecondition = "precondition"
+	PhaseInject       = "inject"
+	PhaseVerify       = "verify"
+	PhaseRollback     = "rollback"
+)
+
+// PhaseResult records the outcome of one phase of a scenario execution
+type PhaseResult struct {
+	Phase string
+	Start time.Time
+	End   time.Time
+	Err   error
+}
+
+// Target is a resource affected by a scenario
+type Target struct {
+	Kind       string `json:"kind"`
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+// Action is a mutating call made against a target
+type Action struct {
+	Time   time.Time `json:"time"`
+	Verb   string    `json:"verb"`
+	Target Target    `json:"target"`
+}
+
+// Execution records a single run of a scenario through its phases
+type Execution struct {
+	Scenario string
+	Start    time.Time
+	End      time.Time
+	Phases   []PhaseResult
+	Targets  []Target
+	Actions  []Action
+	// OnAction, if set, is called with every action as it is recorded
+	OnAction func(Action)
+}
+
+type executionKey struct{}
+
+// WithExecution returns a context carrying the execution, so that the
+// actions taken on its behalf can be recorded
+func WithExecution(ctx context.Context, ex *Execution) context.Context {
+	return context.WithValue(ctx, executionKey{}, ex)
+}
+
+// ExecutionFromContext returns the execution carried by the context, nil
+// if there is none
+func ExecutionFromContext(ctx context.Context) *Execution {
+	ex, _ := ctx.Value(executionKey{}).(*Execution)
+	return ex
+}
+
+// NewExecution returns a new Execution for the given scenario
+func NewExecution(scenario string) *Execution {
+	return &Execution{
+		Scenario: scenario,
+		Start:    time.Now(),
+	}
+}
+
+// RunPhase runs fn as the given phase and records its result
+func (ex *Execution) RunPhase(phase string, fn func() error) error {
+	result := PhaseResult{
+		Phase: phase,
+		Start: time.Now(),
+	}
+	result.Err = fn()
+	result.End = time.Now()
+	ex.Phases = append(ex.Phases, result)
+	return result.Err
+}
+
+// AddTarget records a resource affected by the scenario
+func (ex *Execution) AddTarget(t Target) {
+	ex.Targets = append(ex.Targets, t)
+}
+
+// AddAction records a mutating call made against a target. It is safe to
+// call on a nil Execution.
+func (ex *Execution) AddAction(verb string, t Target) {
+	if ex == nil {
+		return
+	}
+	a := Action{
+		Time:   time.Now(),
+		Verb:   verb,
+		Target: t,
+	}
+	ex.Actions = append(ex.Actions, a)
+	if ex.OnAction != nil {
+		ex.OnAction(a)
+	}
+}
+
+// TargetsOfKind returns the targets of the given kind
+func (ex *Execution) TargetsOfKind(kind string) []Target {
+	var targets []Target
+	for _, t := range ex.Targets {
+		if t.Kind == kind {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// GetPhase returns the result of the given phase, nil if it didn't run
+func (ex *Execution) GetPhase(phase string) *PhaseResult {
+	for i := range ex.Phases {
+		if ex.Phases[i].Phase == phase {
+			return &ex.Phases[i]
+		}
+	}
+	return nil
+}
+
+// Finish marks the end of the execution
+func (ex *Execution) Finish() {
+	ex.End = time.Now()
+}
+
+// Succeeded returns true if none of the phases of the execution failed
+func (ex *Execution) Succeeded() bool {
+	for _, p := range ex.Phases {
+		if p.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Skipped returns true if the precondition of the scenario wasn't met and
+// hence no fault was injected
+func (ex *Execution) Skipped() bool {
+	p := ex.GetPhase(PhasePrecondition)
+	return p != nil && p.Err != nil
+}
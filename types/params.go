@@ -0,0 +1,61 @@
+package types
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Params are the parameters of a scenario, as key/value pairs
+type Params map[string]string
+
+// Merge returns a copy of the params overridden by the given ones
+func (p Params) Merge(overrides Params) Params {
+	merged := Params{}
+	for k, v := range p {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// String returns the value of the param, def if it isn't set
+func (p Params) String(key, def string) string {
+	if v, ok := p[key]; ok {
+		return v
+	}
+	return def
+}
+
+// Int returns the value of the param as an int, def if it isn't set or
+// isn't a valid int
+func (p Params) Int(key string, def int) int {
+	v, ok := p[key]
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		logrus.Errorf("invalid value %q for param %v, using %v: %v", v, key, def, err)
+		return def
+	}
+	return i
+}
+
+// Duration returns the value of the param as a duration, def if it isn't
+// set or isn't a valid duration
+func (p Params) Duration(key string, def time.Duration) time.Duration {
+	v, ok := p[key]
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logrus.Errorf("invalid value %q for param %v, using %v: %v", v, key, def, err)
+		return def
+	}
+	return d
+}
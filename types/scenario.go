@@ -1,15 +1,52 @@
 package types
 
 import (
-//"github.com/rancher/go-rancher/v2"
+	"context"
+	"time"
+	//"github.com/rancher/go-rancher/v2"
 )
 
 // Scenario ...
 type Scenario interface {
+	// GetID returns the unique identifier of the scenario
+	GetID() string
 	// GetName ...
 	GetName() string
-	// Run ...
-	Run(*SharedInfo) error
+	// GetWeight returns the relative likelihood of the scenario being picked
+	GetWeight() int
+	// IsEligible reports whether the scenario can be run against the
+	// current setup, and if not, the reason why
+	IsEligible(*SharedInfo) (bool, string)
+	// Run injects the fault, recording the affected resources in the
+	// Execution
+	Run(context.Context, *SharedInfo, *Execution) error
 	// IsSkip ...
 	IsSkip() bool
 }
+
+// Preconditioner is implemented by scenarios which need to check that
+// the cluster is ready before the fault is injected
+type Preconditioner interface {
+	Precondition(context.Context, *SharedInfo) error
+}
+
+// Verifier is implemented by scenarios which can check that the cluster
+// recovered from the injected fault. Verify is retried until it succeeds
+// or GetVerifyTimeout has elapsed.
+type Verifier interface {
+	Verify(context.Context, *SharedInfo, *Execution) error
+	GetVerifyTimeout() time.Duration
+}
+
+// RollBacker is implemented by scenarios which can undo the damage done
+// when either the injection or the verification fails
+type RollBacker interface {
+	Rollback(context.Context, *SharedInfo, *Execution) error
+}
+
+// RateLimited is implemented by scenarios which must not run too often.
+// Zero values disable the limits.
+type RateLimited interface {
+	GetCooldown() time.Duration
+	GetMaxPerHour() int
+}
@@ -1,14 +1,21 @@
 package types
 
 import (
-	"github.com/rancher/go-rancher/v2"
+	"time"
+
+	"github.com/leodotcloud/chaos-monkey/blast"
+	"github.com/leodotcloud/chaos-monkey/cooldown"
+	"github.com/leodotcloud/chaos-monkey/docker"
+	"github.com/leodotcloud/chaos-monkey/rancher"
+	"github.com/leodotcloud/chaos-monkey/random"
+	"github.com/leodotcloud/chaos-monkey/selector"
 )
 
-// SharedInfo ...
+// SharedInfo is shared by the scenarios, which may run concurrently. Its
+// fields are set before the run starts.
 type SharedInfo struct {
-	Client                  *client.RancherClient
-	RawClient               *client.RancherClient
-	DockerProxies           map[string]string
+	Client                  *rancher.Client
+	RawClient               *rancher.Client
 	UseDigitalOcean         bool
 	DigitalOceanAccessToken string
 	UseAWS                  bool
@@ -22,4 +29,46 @@ type SharedInfo struct {
 	MaxClusterSize          int
 	DisableAddHostScenario  bool
 	DisableDelHostScenario  bool
+	DryRun                  bool
+	// AWSRegions, AWSAMIs, AWSInstanceTypes, AWSVPCIDs, AWSSubnetIDs and
+	// AWSSecurityGroups are the options the EC2 instances are created
+	// with, picked at random
+	AWSRegions        []string
+	AWSAMIs           []string
+	AWSInstanceTypes  []string
+	AWSVPCIDs         []string
+	AWSSubnetIDs      []string
+	AWSSecurityGroups []string
+	// PacketOSes, PacketPlans and PacketFacilities are the options the
+	// Packet machines are created with, picked at random
+	PacketOSes       []string
+	PacketPlans      []string
+	PacketFacilities []string
+	// Random is the source of every random decision of the run
+	Random *random.Source
+	// Campaign identifies the run, which spans restarts when resumed
+	// from a journal. The resources created are labeled with it.
+	Campaign string
+	// InstanceID identifies the chaos monkey among the ones sharing a
+	// Rancher server. The resources created are labeled with it, and only
+	// the ones labeled with it are touched.
+	InstanceID string
+	// Protected lists the resources no scenario ever acts on
+	Protected selector.Rules
+	// OptIn restricts the scenarios to the resources labeled as opted in
+	OptIn bool
+	// MinHealthy is the number of healthy instances no service is left
+	// below, and MinHealthyPercent the same as a percentage of its scale
+	MinHealthy        int
+	MinHealthyPercent int
+	// TargetCooldown is the minimum time before an instance or host is hit
+	// again, and RecentTargets remembers when they were hit
+	TargetCooldown time.Duration
+	RecentTargets  *cooldown.Tracker
+	// BlastRadius keeps the targets of the scenarios running concurrently
+	// apart and within budget, nil if they don't run concurrently
+	BlastRadius *blast.Radius
+
+	// Docker reaches the docker daemons of the hosts
+	Docker docker.Executor
 }
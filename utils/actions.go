@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// dryRun logs the mutating action about to be taken. It returns true when
+// running in dry-run mode, in which case the caller must not execute it.
+func dryRun(si *types.SharedInfo, format string, args ...interface{}) bool {
+	if !si.DryRun {
+		return false
+	}
+	logrus.Infof("[dry-run] would "+format, args...)
+	return true
+}
+
+// recordAction records a mutating action which was taken in the execution
+// carried by the context, if any
+func recordAction(ctx context.Context, verb string, t types.Target) {
+	types.ExecutionFromContext(ctx).AddAction(verb, t)
+}
+
+// HostTarget ...
+func HostTarget(host *client.Host) types.Target {
+	return types.Target{Kind: "host", ID: host.Id, Name: host.Name}
+}
+
+// InstanceTarget ...
+func InstanceTarget(instance *client.Instance) types.Target {
+	return types.Target{
+		Kind:       "instance",
+		ID:         instance.Id,
+		Name:       instance.Name,
+		ExternalID: instance.ExternalId,
+	}
+}
+
+// ServiceTarget ...
+func ServiceTarget(service *client.Service) types.Target {
+	return types.Target{Kind: "service", ID: service.Id, Name: service.Name}
+}
+
+// ProjectTarget ...
+func ProjectTarget(project *client.Project) types.Target {
+	return types.Target{Kind: "project", ID: project.Id, Name: project.Name}
+}
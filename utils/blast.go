@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/blast"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// blastOwner returns the execution on behalf of which the targets are
+// claimed, nil if there is none
+func blastOwner(ctx context.Context) interface{} {
+	if ex := types.ExecutionFromContext(ctx); ex != nil {
+		return ex
+	}
+	return nil
+}
+
+func hostBlastTarget(host *client.Host) blast.Target {
+	return blast.Target{Host: host.Id}
+}
+
+func instanceBlastTarget(ctx context.Context, si *types.SharedInfo, instance *client.Instance) (blast.Target, error) {
+	t := blast.Target{
+		Host:     instance.HostId,
+		Instance: instance.Id,
+	}
+	if err := ctx.Err(); err != nil {
+		return t, err
+	}
+	container, err := si.Client.Container.ById(instance.Id)
+	if err != nil {
+		return t, fmt.Errorf("error getting container %v: %v", instance.Name, err)
+	}
+	if container != nil && len(container.ServiceIds) > 0 {
+		t.Service = container.ServiceIds[0]
+	}
+	return t, nil
+}
+
+// spareInstances leaves out the instances which can't be affected
+// along with the targets of the scenarios running concurrently
+func spareInstances(ctx context.Context, si *types.SharedInfo, instances []client.Instance) ([]client.Instance, error) {
+	owner := blastOwner(ctx)
+	if si.BlastRadius == nil || owner == nil {
+		return instances, nil
+	}
+
+	var spare []client.Instance
+	for i := range instances {
+		t, err := instanceBlastTarget(ctx, si, &instances[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := si.BlastRadius.Check(owner, t); err != nil {
+			logrus.Infof("not targeting instance %v: %v", instances[i].Name, err)
+			continue
+		}
+		spare = append(spare, instances[i])
+	}
+	return spare, nil
+}
+
+// spareHosts leaves out the hosts which can't be affected along with the
+// targets of the scenarios running concurrently
+func spareHosts(ctx context.Context, si *types.SharedInfo, hosts []client.Host) []client.Host {
+	owner := blastOwner(ctx)
+	if si.BlastRadius == nil || owner == nil {
+		return hosts
+	}
+
+	var spare []client.Host
+	for i := range hosts {
+		if err := si.BlastRadius.Check(owner, hostBlastTarget(&hosts[i])); err != nil {
+			logrus.Infof("not targeting host %v: %v", hosts[i].Name, err)
+			continue
+		}
+		spare = append(spare, hosts[i])
+	}
+	return spare
+}
+
+// claimInstance records that the scenario affects the instance, failing
+// if a concurrent scenario claimed an overlapping target meanwhile, and
+// starts the cooldown of the instance
+func claimInstance(ctx context.Context, si *types.SharedInfo, instance *client.Instance) error {
+	if owner := blastOwner(ctx); si.BlastRadius != nil && owner != nil {
+		t, err := instanceBlastTarget(ctx, si, instance)
+		if err != nil {
+			return err
+		}
+		if err := si.BlastRadius.Claim(owner, t); err != nil {
+			return err
+		}
+	}
+	hitTarget(si, "instance", instance.Id)
+	return nil
+}
+
+// claimHost records that the scenario affects the host, failing if a
+// concurrent scenario claimed an overlapping target meanwhile, and starts
+// the cooldown of the host
+func claimHost(ctx context.Context, si *types.SharedInfo, host *client.Host) error {
+	if owner := blastOwner(ctx); si.BlastRadius != nil && owner != nil {
+		if err := si.BlastRadius.Claim(owner, hostBlastTarget(host)); err != nil {
+			return err
+		}
+	}
+	hitTarget(si, "host", host.Id)
+	return nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+func targetKey(kind, id string) string {
+	return kind + "/" + id
+}
+
+// hitTarget starts the cooldown of the target
+func hitTarget(si *types.SharedInfo, kind, id string) {
+	si.RecentTargets.Hit(targetKey(kind, id), time.Now())
+}
+
+// RestoreTargetCooldowns restarts the cooldown of the instances and
+// hosts acted on, e.g. by the run a journal is resumed from
+func RestoreTargetCooldowns(si *types.SharedInfo, actions []types.Action) {
+	for _, a := range actions {
+		switch a.Target.Kind {
+		case "instance", "host":
+			si.RecentTargets.Hit(targetKey(a.Target.Kind, a.Target.ID), a.Time)
+		}
+	}
+}
+
+// restedInstances leaves out the instances hit within the target cooldown
+func restedInstances(si *types.SharedInfo, instances []client.Instance) []client.Instance {
+	if si.RecentTargets == nil {
+		return instances
+	}
+
+	now := time.Now()
+	var rested []client.Instance
+	for _, instance := range instances {
+		ready, reason := si.RecentTargets.Ready(targetKey("instance", instance.Id), now, si.TargetCooldown, 0)
+		if !ready {
+			logrus.Infof("not targeting instance %v: %v", instance.Name, reason)
+			continue
+		}
+		rested = append(rested, instance)
+	}
+	return rested
+}
+
+// restedHosts leaves out the hosts hit, or added, within the target
+// cooldown
+func restedHosts(si *types.SharedInfo, hosts []client.Host) []client.Host {
+	if si.RecentTargets == nil {
+		return hosts
+	}
+
+	now := time.Now()
+	var rested []client.Host
+	for _, host := range hosts {
+		ready, reason := si.RecentTargets.Ready(targetKey("host", host.Id), now, si.TargetCooldown, 0)
+		if !ready {
+			logrus.Infof("not targeting host %v: %v", host.Name, reason)
+			continue
+		}
+		rested = append(rested, host)
+	}
+	return rested
+}
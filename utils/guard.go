@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// DefaultMinHealthy is the number of healthy instances a service keeps
+// unless configured otherwise, so that its last one is never killed
+const DefaultMinHealthy = 1
+
+// serviceHealth counts the healthy instances of a service
+type serviceHealth struct {
+	service  *client.Service
+	healthy  map[string]bool
+	required int
+}
+
+// isHealthy returns true if the container is running and, if it has a
+// health check, reported healthy by Rancher
+func isHealthy(container *client.Container) bool {
+	return container.State == "running" &&
+		(container.HealthState == "" || container.HealthState == "healthy")
+}
+
+// minHealthy returns how many of the instances of a service of the given
+// scale must stay healthy
+func minHealthy(si *types.SharedInfo, scale int) int {
+	required := si.MinHealthy
+	if percent := si.MinHealthyPercent; percent > 0 {
+		if r := (scale*percent + 99) / 100; r > required {
+			required = r
+		}
+	}
+	return required
+}
+
+func getServiceHealth(ctx context.Context, si *types.SharedInfo, service *client.Service) (*serviceHealth, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	containers, err := si.Client.Service.ListInstances(service)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the instances of service %v: %v", service.Name, err)
+	}
+
+	h := &serviceHealth{
+		service: service,
+		healthy: map[string]bool{},
+	}
+	for i := range containers.Data {
+		if isHealthy(&containers.Data[i]) {
+			h.healthy[containers.Data[i].Id] = true
+		}
+	}
+
+	scale := int(service.Scale)
+	if scale <= 0 {
+		scale = len(containers.Data)
+	}
+	h.required = minHealthy(si, scale)
+	return h, nil
+}
+
+// GuardMinHealthy leaves out the instances whose loss would drop the
+// healthy instances of their service below the minimum
+func GuardMinHealthy(ctx context.Context, si *types.SharedInfo, instances []client.Instance) ([]client.Instance, error) {
+	services := map[string]*serviceHealth{}
+	var allowed []client.Instance
+	for _, instance := range instances {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		container, err := si.Client.Container.ById(instance.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting container %v: %v", instance.Name, err)
+		}
+		if container == nil || len(container.ServiceIds) == 0 {
+			allowed = append(allowed, instance)
+			continue
+		}
+
+		serviceID := container.ServiceIds[0]
+		h, ok := services[serviceID]
+		if !ok {
+			service, err := si.Client.Service.ById(serviceID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting service %v: %v", serviceID, err)
+			}
+			if service != nil {
+				if h, err = getServiceHealth(ctx, si, service); err != nil {
+					return nil, err
+				}
+			}
+			services[serviceID] = h
+		}
+		if h == nil {
+			allowed = append(allowed, instance)
+			continue
+		}
+
+		left := len(h.healthy)
+		if h.healthy[instance.Id] {
+			left--
+		}
+		if left < h.required {
+			logrus.Infof("not targeting instance %v: service %v would be left with %v healthy instances, below the minimum of %v",
+				instance.Name, h.service.Name, left, h.required)
+			continue
+		}
+		allowed = append(allowed, instance)
+	}
+	return allowed, nil
+}
+
+// targetInstances returns the instances selected by the selector which
+// are not cooling down, whose loss leaves their services healthy enough,
+// and which don't overlap the targets of the scenarios running
+// concurrently
+func targetInstances(ctx context.Context, si *types.SharedInfo, sel selector.Selector, instances []client.Instance) ([]client.Instance, error) {
+	selected, err := SelectInstances(ctx, si, sel, instances)
+	if err != nil {
+		return nil, err
+	}
+	selected = restedInstances(si, selected)
+	allowed, err := GuardMinHealthy(ctx, si, selected)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) > 0 && len(allowed) == 0 {
+		logrus.Warnf("fault suppressed for safety: none of the %v selected instances can be lost without leaving its service below the minimum healthy instances",
+			len(selected))
+		return nil, fmt.Errorf("fault suppressed for safety: services would be left below the minimum healthy instances")
+	}
+	return spareInstances(ctx, si, allowed)
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// Hosts, and the containers of services, carry the ownership of the
+// resources created by the chaos monkey as labels. Stacks and services
+// carry it in their external ID and projects in their description, as
+// they don't have labels.
+const (
+	// InstanceLabel is the ID of the chaos monkey instance owning the
+	// resource
+	InstanceLabel = "io.rancher.chaosmonkey.instance"
+	// RunLabel is the ID of the run which created the resource
+	RunLabel = "io.rancher.chaosmonkey.run"
+	// DefaultInstanceID is the ID of the chaos monkey instance unless
+	// several are run side by side
+	DefaultInstanceID = "default"
+
+	ownerExternalIDPrefix  = "chaosmonkey://"
+	ownerDescriptionPrefix = "Created by chaos-monkey: "
+)
+
+var validInstanceID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidateInstanceID checks that the ID can be used in labels, external
+// IDs and project names
+func ValidateInstanceID(id string) error {
+	if !validInstanceID.MatchString(id) {
+		return fmt.Errorf("invalid instance ID %q: only letters, digits, '_', '.' and '-' are allowed", id)
+	}
+	return nil
+}
+
+// ownerLabels are the labels of the hosts and containers created by the
+// chaos monkey, which are opted in to its scenarios
+func ownerLabels(si *types.SharedInfo) map[string]interface{} {
+	return map[string]interface{}{
+		InstanceLabel: si.InstanceID,
+		RunLabel:      si.Campaign,
+		EnabledLabel:  "true",
+	}
+}
+
+// ownerExternalID is the external ID of the stacks and services created
+// by the chaos monkey: chaosmonkey://<instance>/<run>
+func ownerExternalID(si *types.SharedInfo) string {
+	return ownerExternalIDPrefix + si.InstanceID + "/" + si.Campaign
+}
+
+// ownerDescription is the description of the project created by the
+// chaos monkey
+func ownerDescription(si *types.SharedInfo) string {
+	return ownerDescriptionPrefix + InstanceLabel + "=" + si.InstanceID + " " + RunLabel + "=" + si.Campaign
+}
+
+// ownerOfExternalID returns the instance owning a stack or service with the
+// external ID, or an empty string if it isn't owned by any
+func ownerOfExternalID(externalID string) string {
+	if !strings.HasPrefix(externalID, ownerExternalIDPrefix) {
+		return ""
+	}
+	owner := strings.TrimPrefix(externalID, ownerExternalIDPrefix)
+	if i := strings.Index(owner, "/"); i >= 0 {
+		owner = owner[:i]
+	}
+	return owner
+}
+
+// HostOwner returns the chaos monkey instance owning the host, or an empty
+// string if it isn't owned by any
+func HostOwner(host *client.Host) string {
+	owner, _ := host.Labels[InstanceLabel].(string)
+	return owner
+}
+
+// StackOwner returns the chaos monkey instance owning the stack, or an
+// empty string if it isn't owned by any
+func StackOwner(stack *client.Stack) string {
+	return ownerOfExternalID(stack.ExternalId)
+}
+
+// ProjectOwner returns the chaos monkey instance owning the project, or an
+// empty string if it isn't owned by any
+func ProjectOwner(project *client.Project) string {
+	if !strings.HasPrefix(project.Description, ownerDescriptionPrefix) {
+		return ""
+	}
+	for _, field := range strings.Fields(strings.TrimPrefix(project.Description, ownerDescriptionPrefix)) {
+		if strings.HasPrefix(field, InstanceLabel+"=") {
+			return strings.TrimPrefix(field, InstanceLabel+"=")
+		}
+	}
+	return ""
+}
+
+// IsOwnedHost returns true if the host was created by this chaos monkey
+// instance
+func IsOwnedHost(si *types.SharedInfo, host *client.Host) bool {
+	return HostOwner(host) == si.InstanceID
+}
+
+// IsOwnedStack returns true if the stack was created by this chaos monkey
+// instance
+func IsOwnedStack(si *types.SharedInfo, stack *client.Stack) bool {
+	return StackOwner(stack) == si.InstanceID
+}
+
+// IsOwnedService returns true if the service was created by this chaos
+// monkey instance
+func IsOwnedService(si *types.SharedInfo, service *client.Service) bool {
+	return ownerOfExternalID(service.ExternalId) == si.InstanceID
+}
+
+// IsOwnedProject returns true if the project was created by this chaos
+// monkey instance
+func IsOwnedProject(si *types.SharedInfo, project *client.Project) bool {
+	return ProjectOwner(project) == si.InstanceID
+}
+
+// ChaosMonkeyProjectName returns the name of the project created for the
+// chaos monkey instance, unless one is given
+func ChaosMonkeyProjectName(si *types.SharedInfo) string {
+	if si.InstanceID == DefaultInstanceID {
+		return "chaosmonkey"
+	}
+	return "chaosmonkey-" + si.InstanceID
+}
+
+// ListHosts returns the hosts of the project matching the options, from
+// all the pages
+func ListHosts(ctx context.Context, si *types.SharedInfo, opts *client.ListOpts) ([]client.Host, error) {
+	collection, err := si.Client.Host.List(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []client.Host
+	for collection != nil {
+		hosts = append(hosts, collection.Data...)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collection, err = collection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+// listStacks returns the stacks of the project matching the options,
+// from all the pages
+func listStacks(ctx context.Context, si *types.SharedInfo, opts *client.ListOpts) ([]client.Stack, error) {
+	collection, err := si.Client.Stack.List(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var stacks []client.Stack
+	for collection != nil {
+		stacks = append(stacks, collection.Data...)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collection, err = collection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stacks, nil
+}
+
+// ListServices returns the services of the project matching the options,
+// from all the pages
+func ListServices(ctx context.Context, si *types.SharedInfo, opts *client.ListOpts) ([]client.Service, error) {
+	collection, err := si.Client.Service.List(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []client.Service
+	for collection != nil {
+		services = append(services, collection.Data...)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collection, err = collection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return services, nil
+}
+
+// ListOwnedHosts returns the hosts owned by this chaos monkey instance,
+// including the ones being removed
+func ListOwnedHosts(ctx context.Context, si *types.SharedInfo) ([]client.Host, error) {
+	hosts, err := ListHosts(ctx, si, &client.ListOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []client.Host
+	for _, host := range hosts {
+		if IsOwnedHost(si, &host) {
+			owned = append(owned, host)
+		}
+	}
+	return owned, nil
+}
+
+// FindOwnedStack returns the stack with the name owned by this chaos
+// monkey instance, which is not being removed, or nil if there is none
+func FindOwnedStack(ctx context.Context, si *types.SharedInfo, name string) (*client.Stack, error) {
+	stacks, err := listStacks(ctx, si, &client.ListOpts{
+		Filters: map[string]interface{}{
+			"name_eq": name,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stack := range stacks {
+		if IsOwnedStack(si, &stack) && !isGone(stack.State) {
+			return &stack, nil
+		}
+	}
+	return nil, nil
+}
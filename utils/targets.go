@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/selector"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// Teams sharing the environment mark their containers, services and
+// hosts with these labels
+const (
+	// ExcludeLabel set to true keeps the scenarios off the resource, and
+	// off the containers of a service or a host
+	ExcludeLabel = "io.rancher.chaos.exclude"
+	// EnabledLabel set to true opts the resource in, when only opted in
+	// resources are eligible
+	EnabledLabel = "io.rancher.chaos.enabled"
+)
+
+// candidates builds the candidates for the selectors, caching the
+// stacks, services and hosts looked up
+type candidates struct {
+	si       *types.SharedInfo
+	stacks   map[string]string
+	services map[string]*client.Service
+	hosts    map[string]*client.Host
+}
+
+func newCandidates(si *types.SharedInfo) *candidates {
+	return &candidates{
+		si:       si,
+		stacks:   map[string]string{},
+		services: map[string]*client.Service{},
+		hosts:    map[string]*client.Host{},
+	}
+}
+
+func stringLabels(labels map[string]interface{}) map[string]string {
+	result := map[string]string{}
+	for k, v := range labels {
+		result[k] = fmt.Sprint(v)
+	}
+	return result
+}
+
+func hostName(host *client.Host) string {
+	if host.Name != "" {
+		return host.Name
+	}
+	return host.Hostname
+}
+
+func (c *candidates) stackName(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	if name, ok := c.stacks[id]; ok {
+		return name, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	stack, err := c.si.Client.Stack.ById(id)
+	if err != nil {
+		return "", fmt.Errorf("error getting stack %v: %v", id, err)
+	}
+	name := ""
+	if stack != nil {
+		name = stack.Name
+	}
+	c.stacks[id] = name
+	return name, nil
+}
+
+func (c *candidates) service(ctx context.Context, id string) (*client.Service, error) {
+	if service, ok := c.services[id]; ok {
+		return service, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	service, err := c.si.Client.Service.ById(id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting service %v: %v", id, err)
+	}
+	c.services[id] = service
+	return service, nil
+}
+
+func (c *candidates) host(ctx context.Context, id string) (*client.Host, error) {
+	if id == "" {
+		return nil, nil
+	}
+	if host, ok := c.hosts[id]; ok {
+		return host, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	host, err := c.si.Client.Host.ById(id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting host %v: %v", id, err)
+	}
+	c.hosts[id] = host
+	return host, nil
+}
+
+// forInstance describes the instance, with the stack, service, labels
+// and host of its container
+func (c *candidates) forInstance(ctx context.Context, instance *client.Instance) (*selector.Candidate, error) {
+	candidate := &selector.Candidate{
+		Kind:  "instance",
+		Name:  instance.Name,
+		State: instance.State,
+	}
+
+	container, err := c.si.Client.Container.ById(instance.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting container %v: %v", instance.Name, err)
+	}
+	hostID := instance.HostId
+	if container != nil {
+		candidate.Labels = stringLabels(container.Labels)
+		if candidate.Stack, err = c.stackName(ctx, container.StackId); err != nil {
+			return nil, err
+		}
+		if len(container.ServiceIds) > 0 {
+			service, err := c.service(ctx, container.ServiceIds[0])
+			if err != nil {
+				return nil, err
+			}
+			if service != nil {
+				candidate.Service = service.Name
+				if service.LaunchConfig != nil {
+					candidate.ServiceLabels = stringLabels(service.LaunchConfig.Labels)
+				}
+			}
+		}
+		if hostID == "" {
+			hostID = container.HostId
+		}
+	}
+
+	host, err := c.host(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+	if host != nil {
+		candidate.Host = hostName(host)
+		candidate.HostLabels = stringLabels(host.Labels)
+	}
+	return candidate, nil
+}
+
+func forHost(host *client.Host) *selector.Candidate {
+	labels := stringLabels(host.Labels)
+	return &selector.Candidate{
+		Kind:       "host",
+		Name:       hostName(host),
+		State:      host.State,
+		Labels:     labels,
+		Host:       hostName(host),
+		HostLabels: labels,
+	}
+}
+
+func isTrue(labels map[string]string, key string) bool {
+	b, _ := strconv.ParseBool(labels[key])
+	return b
+}
+
+// labelDecision returns why the labels of the candidate, or of its
+// service or host, keep the scenarios off it, if they do
+func labelDecision(si *types.SharedInfo, c *selector.Candidate) (bool, string) {
+	if c.Kind == "host" {
+		if isTrue(c.Labels, ExcludeLabel) {
+			return false, "opted out by host label " + ExcludeLabel + "=true"
+		}
+		if si.OptIn && !isTrue(c.Labels, EnabledLabel) {
+			return false, "not opted in by host label " + EnabledLabel + "=true"
+		}
+		return true, ""
+	}
+
+	if isTrue(c.Labels, ExcludeLabel) {
+		return false, "opted out by container label " + ExcludeLabel + "=true"
+	}
+	if isTrue(c.ServiceLabels, ExcludeLabel) {
+		return false, fmt.Sprintf("opted out by label %v=true of service %v", ExcludeLabel, c.Service)
+	}
+	if isTrue(c.HostLabels, ExcludeLabel) {
+		return false, fmt.Sprintf("opted out by label %v=true of host %v", ExcludeLabel, c.Host)
+	}
+	if si.OptIn && !isTrue(c.Labels, EnabledLabel) && !isTrue(c.ServiceLabels, EnabledLabel) {
+		return false, "not opted in by container or service label " + EnabledLabel + "=true"
+	}
+	return true, ""
+}
+
+// selectCandidate applies the labels of the candidate, the protected
+// rules and then the selector
+func selectCandidate(si *types.SharedInfo, sel selector.Selector, c *selector.Candidate) bool {
+	if ok, reason := labelDecision(si, c); !ok {
+		logrus.Infof("not targeting %v %v: %v", c.Kind, c.Name, reason)
+		return false
+	}
+	if r, ok := si.Protected.Match(c); ok {
+		logrus.Infof("not targeting %v %v: protected by rule %v", c.Kind, c.Name, r)
+		return false
+	}
+	if ok, reason := sel.Select(c); !ok {
+		logrus.Debugf("not targeting %v %v: %v", c.Kind, c.Name, reason)
+		return false
+	}
+	return true
+}
+
+// SelectInstances returns the instances selected by the selector, leaving
+// out the protected ones
+func SelectInstances(ctx context.Context, si *types.SharedInfo, sel selector.Selector, instances []client.Instance) ([]client.Instance, error) {
+	c := newCandidates(si)
+	var selected []client.Instance
+	for i := range instances {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		candidate, err := c.forInstance(ctx, &instances[i])
+		if err != nil {
+			return nil, err
+		}
+		if selectCandidate(si, sel, candidate) {
+			selected = append(selected, instances[i])
+		}
+	}
+	return selected, nil
+}
+
+// SelectHosts returns the hosts selected by the selector, leaving out the
+// protected ones
+func SelectHosts(si *types.SharedInfo, sel selector.Selector, hosts []client.Host) []client.Host {
+	var selected []client.Host
+	for i := range hosts {
+		if selectCandidate(si, sel, forHost(&hosts[i])) {
+			selected = append(selected, hosts[i])
+		}
+	}
+	return selected
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+const (
+	// teardownTimeout bounds the wait for each step of the removal of a
+	// resource
+	teardownTimeout = 10 * time.Minute
+	// teardownInterval is how often the state of a resource being removed
+	// is checked
+	teardownInterval = 5 * time.Second
+)
+
+// Teardown removes the hosts and stacks owned by this chaos monkey
+// instance in the project, along with the created hosts, which are known
+// from a journal, then the project itself if it owns it, waiting for each
+// removal. It carries on after a failure, and returns an error listing the
+// resources left over.
+func Teardown(ctx context.Context, si *types.SharedInfo, project *client.Project, created []types.Target) error {
+	var leftovers []string
+	leftover := func(kind, name, id string, err error) {
+		logrus.Errorf("error removing %v %v (%v): %v", kind, name, id, err)
+		leftovers = append(leftovers, fmt.Sprintf("%v %v (%v)", kind, name, id))
+	}
+
+	// Resources of other chaos monkey instances keep the project around
+	foreign := false
+
+	journaled := map[string]bool{}
+	for _, t := range created {
+		journaled[t.ID] = true
+	}
+
+	hosts, err := ListHosts(ctx, si, &client.ListOpts{})
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if IsHostGone(&host) {
+			continue
+		}
+		if !IsOwnedHost(si, &host) && !journaled[host.Id] {
+			if owner := HostOwner(&host); owner != "" {
+				logrus.Infof("host %v (%v) is owned by chaos monkey instance %v, leaving it",
+					host.Name, host.Id, owner)
+				foreign = true
+			}
+			continue
+		}
+		if err := teardownHost(ctx, si, &host); err != nil {
+			leftover("host", host.Name, host.Id, err)
+		}
+	}
+
+	stacks, err := listStacks(ctx, si, &client.ListOpts{})
+	if err != nil {
+		return err
+	}
+	for _, stack := range stacks {
+		if isGone(stack.State) {
+			continue
+		}
+		if !IsOwnedStack(si, &stack) {
+			if owner := StackOwner(&stack); owner != "" {
+				logrus.Infof("stack %v (%v) is owned by chaos monkey instance %v, leaving it",
+					stack.Name, stack.Id, owner)
+				foreign = true
+			}
+			continue
+		}
+		if err := teardownStack(ctx, si, &stack); err != nil {
+			leftover("stack", stack.Name, stack.Id, err)
+		}
+	}
+
+	if !IsOwnedProject(si, project) {
+		logrus.Infof("project %v (%v) isn't owned by chaos monkey instance %v, leaving it",
+			project.Name, project.Id, si.InstanceID)
+	} else if foreign {
+		logrus.Infof("project %v (%v) still has resources of other chaos monkey instances, leaving it",
+			project.Name, project.Id)
+	} else if len(leftovers) > 0 {
+		logrus.Warnf("not removing project %v (%v), as it still has leftovers", project.Name, project.Id)
+		leftovers = append(leftovers, fmt.Sprintf("project %v (%v)", project.Name, project.Id))
+	} else if err := teardownProject(ctx, si, project); err != nil {
+		leftover("project", project.Name, project.Id, err)
+	}
+
+	if len(leftovers) > 0 {
+		return fmt.Errorf("leftovers: %v", strings.Join(leftovers, ", "))
+	}
+	logrus.Infof("teardown complete")
+	return nil
+}
+
+// isGone returns true if a resource in the state is removed, or being
+// removed
+func isGone(state string) bool {
+	switch state {
+	case "removing", "removed", "purging", "purged":
+		return true
+	}
+	return false
+}
+
+// waitForState polls the state of a resource until it is one of the
+// states, or the timeout elapses. An empty state means the resource
+// doesn't exist anymore.
+func waitForState(ctx context.Context, what string, getState func() (string, error), states ...string) error {
+	deadline := time.Now().Add(teardownTimeout)
+	for {
+		state, err := getState()
+		if err != nil {
+			return err
+		}
+		for _, s := range append(states, "") {
+			if state == s {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%v still %v after %v, expecting %v", what, state, teardownTimeout, states)
+		}
+		logrus.Debugf("waiting for %v to be %v, currently %v", what, states, state)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(teardownInterval):
+		}
+	}
+}
+
+func teardownHost(ctx context.Context, si *types.SharedInfo, host *client.Host) error {
+	if dryRun(si, "deactivate and delete host %v (%v)", host.Name, host.Id) {
+		return nil
+	}
+	logrus.Infof("removing host %v (%v)", host.Name, host.Id)
+	what := "host " + host.Name
+	getState := func() (string, error) {
+		h, err := si.Client.Host.ById(host.Id)
+		if err != nil || h == nil {
+			return "", err
+		}
+		return h.State, nil
+	}
+
+	// A host being created or activated can only be deactivated once it
+	// settled
+	if IsHostProvisioning(host) {
+		if err := waitForState(ctx, what, getState,
+			"active", "reconnecting", "disconnected", "inactive", "error"); err != nil {
+			return err
+		}
+		h, err := si.Client.Host.ById(host.Id)
+		if err != nil || h == nil {
+			return err
+		}
+		host = h
+	}
+
+	switch host.State {
+	case "active", "reconnecting", "disconnected":
+		if _, err := si.Client.Host.ActionDeactivate(host); err != nil {
+			return err
+		}
+		recordAction(ctx, "deactivate", HostTarget(host))
+		if err := waitForState(ctx, what, getState, "inactive", "error"); err != nil {
+			return err
+		}
+	case "deactivating":
+		if err := waitForState(ctx, what, getState, "inactive", "error"); err != nil {
+			return err
+		}
+	}
+
+	if err := si.Client.Host.Delete(host); err != nil {
+		return err
+	}
+	recordAction(ctx, "delete", HostTarget(host))
+	return waitForState(ctx, what, getState, "removed", "purged")
+}
+
+func teardownStack(ctx context.Context, si *types.SharedInfo, stack *client.Stack) error {
+	target := types.Target{Kind: "stack", ID: stack.Id, Name: stack.Name}
+	if dryRun(si, "delete stack %v (%v)", stack.Name, stack.Id) {
+		return nil
+	}
+	logrus.Infof("removing stack %v (%v)", stack.Name, stack.Id)
+	getState := func() (string, error) {
+		s, err := si.Client.Stack.ById(stack.Id)
+		if err != nil || s == nil {
+			return "", err
+		}
+		return s.State, nil
+	}
+
+	if err := si.Client.Stack.Delete(stack); err != nil {
+		return err
+	}
+	recordAction(ctx, "delete", target)
+	return waitForState(ctx, "stack "+stack.Name, getState, "removed", "purged")
+}
+
+func teardownProject(ctx context.Context, si *types.SharedInfo, project *client.Project) error {
+	if dryRun(si, "deactivate, delete and purge project %v (%v)", project.Name, project.Id) {
+		return nil
+	}
+	logrus.Infof("removing project %v (%v)", project.Name, project.Id)
+	what := "project " + project.Name
+	getState := func() (string, error) {
+		p, err := si.RawClient.Project.ById(project.Id)
+		if err != nil || p == nil {
+			return "", err
+		}
+		return p.State, nil
+	}
+
+	// A project left over by an interrupted teardown carries on from its
+	// state
+	switch project.State {
+	case "active":
+		if _, err := si.RawClient.Project.ActionDeactivate(project); err != nil {
+			return err
+		}
+		recordAction(ctx, "deactivate", ProjectTarget(project))
+		if err := waitForState(ctx, what, getState, "inactive"); err != nil {
+			return err
+		}
+	case "deactivating":
+		if err := waitForState(ctx, what, getState, "inactive"); err != nil {
+			return err
+		}
+	}
+
+	switch project.State {
+	case "removing", "removed", "purging":
+	default:
+		if err := si.RawClient.Project.Delete(project); err != nil {
+			return err
+		}
+		recordAction(ctx, "delete", ProjectTarget(project))
+	}
+	if err := waitForState(ctx, what, getState, "removed", "purged"); err != nil {
+		return err
+	}
+
+	p, err := si.RawClient.Project.ById(project.Id)
+	if err != nil || p == nil || p.State == "purged" {
+		return err
+	}
+	if _, err := si.RawClient.Project.ActionPurge(p); err != nil {
+		return err
+	}
+	recordAction(ctx, "purge", ProjectTarget(project))
+	return waitForState(ctx, what, getState, "purged")
+}
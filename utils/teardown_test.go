@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/leodotcloud/chaos-monkey/rancher/fake"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+func isRemoved(t *testing.T, s *fake.Server, project, kind, id string) bool {
+	res, err := s.Rancher.Get(project, kind, id)
+	if err != nil {
+		return true
+	}
+	return isGone(res["state"].(string))
+}
+
+func TestTeardown(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+
+	active := seed(t, s, projectID, fake.HostKind, ownedHost(si, "cmhost-a", "active"))
+	inactive := seed(t, s, projectID, fake.HostKind, ownedHost(si, "cmhost-b", "inactive"))
+	journaled := seed(t, s, projectID, fake.HostKind, client.Host{Name: "cmhost-c", State: "active"})
+	other := seed(t, s, projectID, fake.HostKind, client.Host{Name: "other", State: "active"})
+	stack := seed(t, s, projectID, fake.StackKind, client.Stack{Name: "cmstack-long", ExternalId: ownerExternalID(si)})
+	otherStack := seed(t, s, projectID, fake.StackKind, client.Stack{Name: "other"})
+
+	project, err := si.RawClient.Project.ById(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := types.NewExecution("teardown")
+	created := []types.Target{{Kind: "host", ID: journaled, Name: "cmhost-c"}}
+	if err := Teardown(types.WithExecution(context.Background(), ex), si, project, created); err != nil {
+		t.Fatalf("Teardown failed: %v", err)
+	}
+
+	for _, id := range []string{active, inactive, journaled} {
+		if !isRemoved(t, s, projectID, fake.HostKind, id) {
+			t.Errorf("host %v was not removed", id)
+		}
+	}
+	if !isRemoved(t, s, projectID, fake.StackKind, stack) {
+		t.Errorf("stack %v was not removed", stack)
+	}
+	if !isRemoved(t, s, "", fake.ProjectKind, projectID) {
+		t.Errorf("project %v was not removed", projectID)
+	}
+	// The resources which aren't owned are only removed along with the
+	// project
+	for _, a := range ex.Actions {
+		if a.Target.ID == other || a.Target.ID == otherStack {
+			t.Errorf("%v %v, not owned, was acted on: %v", a.Target.Kind, a.Target.Name, a.Verb)
+		}
+	}
+
+	deleted := 0
+	for _, a := range ex.Actions {
+		if a.Verb == "delete" {
+			deleted++
+		}
+	}
+	// 3 hosts, the stack and the project
+	if deleted != 5 {
+		t.Errorf("recorded %v deletions, expecting 5: %v", deleted, ex.Actions)
+	}
+}
+
+func TestTeardownKeepsProjectOfOthers(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+
+	owned := seed(t, s, projectID, fake.HostKind, ownedHost(si, "cmhost-a", "active"))
+	otherSI := &types.SharedInfo{InstanceID: "other", Campaign: "test"}
+	foreign := seed(t, s, projectID, fake.HostKind, ownedHost(otherSI, "cmhost-b", "active"))
+
+	project, err := si.RawClient.Project.ById(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Teardown(context.Background(), si, project, nil); err != nil {
+		t.Fatalf("Teardown failed: %v", err)
+	}
+
+	if !isRemoved(t, s, projectID, fake.HostKind, owned) {
+		t.Errorf("host %v was not removed", owned)
+	}
+	if isRemoved(t, s, projectID, fake.HostKind, foreign) {
+		t.Errorf("host %v of another instance was removed", foreign)
+	}
+	if isRemoved(t, s, "", fake.ProjectKind, projectID) {
+		t.Errorf("project %v was removed along with the hosts of another instance", projectID)
+	}
+}
+
+func TestTeardownDryRun(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+	host := seed(t, s, projectID, fake.HostKind, ownedHost(si, "cmhost-a", "active"))
+	si.DryRun = true
+
+	project, err := si.RawClient.Project.ById(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Teardown(context.Background(), si, project, nil); err != nil && !strings.Contains(err.Error(), "leftovers") {
+		t.Fatalf("Teardown failed: %v", err)
+	}
+	if isRemoved(t, s, projectID, fake.HostKind, host) || isRemoved(t, s, "", fake.ProjectKind, projectID) {
+		t.Errorf("a dry run removed resources")
+	}
+}
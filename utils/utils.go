@@ -3,20 +3,20 @@ package utils
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
-	"math/rand"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	dtypes "github.com/docker/docker/api/types"
 	dc "github.com/docker/docker/client"
+	"github.com/leodotcloud/chaos-monkey/provider"
+	"github.com/leodotcloud/chaos-monkey/rancher"
+	"github.com/leodotcloud/chaos-monkey/selector"
 	"github.com/leodotcloud/chaos-monkey/types"
 	"github.com/rancher/go-rancher-metadata/metadata"
 	"github.com/rancher/go-rancher/v2"
-	"github.com/rancher/rancher-docker-api-proxy"
 )
 
 // GetParsedBaseURL ...
@@ -33,7 +33,10 @@ func GetParsedBaseURL(inputURL string) (string, error) {
 }
 
 // GetRawClient ...
-func GetRawClient(url, accessKey, secretKey string) (*client.RancherClient, error) {
+func GetRawClient(ctx context.Context, url, accessKey, secretKey string) (*rancher.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	url = url + "/v2-beta"
 	c, err := client.NewRancherClient(&client.ClientOpts{
 		Url:       url,
@@ -45,15 +48,18 @@ func GetRawClient(url, accessKey, secretKey string) (*client.RancherClient, erro
 		return nil, err
 	}
 
-	return c, nil
+	return rancher.New(c), nil
 }
 
 // GetClientForProject gets the client for a specific Rancher Project.
 // TODO: validates the credentials provided
-func GetClientForProject(url, projectID, accessKey, secretKey string) (*client.RancherClient, error) {
+func GetClientForProject(ctx context.Context, url, projectID, accessKey, secretKey string) (*rancher.Client, error) {
 	if projectID == "" {
 		return nil, fmt.Errorf("no project ID specified")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	url = url + "/v2-beta/projects/" + projectID + "/schemas"
 	c, err := client.NewRancherClient(&client.ClientOpts{
@@ -84,7 +90,7 @@ func GetClientForProject(url, projectID, accessKey, secretKey string) (*client.R
 	//	return nil, err
 	//}
 
-	return c, nil
+	return rancher.New(c), nil
 }
 
 func determineAPIVersion(host *client.Host) string {
@@ -101,163 +107,169 @@ func determineAPIVersion(host *client.Host) string {
 	return fmt.Sprintf("1.%d", num+12)
 }
 
-// ReloadRandomInstanceUsingAPI ...
-func ReloadRandomInstanceUsingAPI(c *client.RancherClient, instances []client.Instance) error {
+func instanceNames(instances []client.Instance) []string {
+	names := make([]string, len(instances))
+	for i, instance := range instances {
+		names[i] = instance.Name
+	}
+	return names
+}
+
+// ReloadRandomInstanceUsingAPI reloads one of the instances selected by
+// the selector whose service can spare it, and returns it
+func ReloadRandomInstanceUsingAPI(ctx context.Context, si *types.SharedInfo, sel selector.Selector, instances []client.Instance) (*client.Instance, error) {
+	instances, err := targetInstances(ctx, si, sel, instances)
+	if err != nil {
+		return nil, err
+	}
 	length := len(instances)
 	if !(length > 0) {
-		return fmt.Errorf("no instances available for reload")
+		return nil, fmt.Errorf("no instances available for reload")
 	}
 
-	randomInstance := instances[rand.Intn(length)]
+	randomInstance := instances[si.Random.Choose("reload-instance", instanceNames(instances), nil)]
+	if err := claimInstance(ctx, si, &randomInstance); err != nil {
+		return nil, err
+	}
 	logrus.Debugf("reloading instance using API: %v", randomInstance.Name)
-	_, err := c.Instance.ActionRestart(&randomInstance)
+	if dryRun(si, "restart instance %v (%v) on host %v", randomInstance.Name, randomInstance.Id, randomInstance.HostId) {
+		return &randomInstance, nil
+	}
+	_, err = si.Client.Instance.ActionRestart(&randomInstance)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	recordAction(ctx, "restart", InstanceTarget(&randomInstance))
+	return &randomInstance, nil
 }
 
-// RemoveRandomInstanceUsingAPI ...
-func RemoveRandomInstanceUsingAPI(c *client.RancherClient, instances []client.Instance) error {
+// RemoveRandomInstanceUsingAPI removes one of the instances selected by
+// the selector whose service can spare it, and returns it
+func RemoveRandomInstanceUsingAPI(ctx context.Context, si *types.SharedInfo, sel selector.Selector, instances []client.Instance) (*client.Instance, error) {
+	instances, err := targetInstances(ctx, si, sel, instances)
+	if err != nil {
+		return nil, err
+	}
 	length := len(instances)
 	if !(length > 0) {
-		return fmt.Errorf("no instances available to remove")
+		return nil, fmt.Errorf("no instances available to remove")
 	}
 
-	randomInstance := instances[rand.Intn(length)]
-	logrus.Debugf("removing instance using docker: %v", randomInstance.Name)
+	randomInstance := instances[si.Random.Choose("remove-instance", instanceNames(instances), nil)]
+	if err := claimInstance(ctx, si, &randomInstance); err != nil {
+		return nil, err
+	}
+	logrus.Debugf("removing instance using API: %v", randomInstance.Name)
+	if dryRun(si, "remove instance %v (%v) on host %v", randomInstance.Name, randomInstance.Id, randomInstance.HostId) {
+		return &randomInstance, nil
+	}
 
-	_, err := c.Instance.ActionRemove(&randomInstance)
+	_, err = si.Client.Instance.ActionRemove(&randomInstance)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	recordAction(ctx, "remove", InstanceTarget(&randomInstance))
+	return &randomInstance, nil
 }
 
-// RemoveRandomInstanceUsingDocker ...
-func RemoveRandomInstanceUsingDocker(si *types.SharedInfo, instances []client.Instance) error {
+// RemoveRandomInstanceUsingDocker removes one of the instances selected
+// by the selector whose service can spare it, and returns it
+func RemoveRandomInstanceUsingDocker(ctx context.Context, si *types.SharedInfo, sel selector.Selector, instances []client.Instance) (*client.Instance, error) {
+	instances, err := targetInstances(ctx, si, sel, instances)
+	if err != nil {
+		return nil, err
+	}
 	length := len(instances)
 	if !(length > 0) {
-		return fmt.Errorf("no instances available to remove")
+		return nil, fmt.Errorf("no instances available to remove")
 	}
 
-	randomInstance := instances[rand.Intn(length)]
+	randomInstance := instances[si.Random.Choose("remove-container", instanceNames(instances), nil)]
+	if err := claimInstance(ctx, si, &randomInstance); err != nil {
+		return nil, err
+	}
 	logrus.Debugf("removing instance using docker: %v", randomInstance.Name)
+	if dryRun(si, "remove container %v (%v) on host %v using docker", randomInstance.Name, randomInstance.ExternalId, randomInstance.HostId) {
+		return &randomInstance, nil
+	}
 
-	dockerClient, err := GetDockerClientForHost(si, randomInstance.HostId)
+	dockerClient, err := GetDockerClientForHost(ctx, si, randomInstance.HostId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	removeOpts := dtypes.ContainerRemoveOptions{
 		Force: true,
 	}
-	err = dockerClient.ContainerRemove(context.Background(), randomInstance.ExternalId, removeOpts)
-	if err != nil {
-		return nil
-	}
-
-	return nil
-}
-
-// GetDockerProxyInfoForHost ...
-func GetDockerProxyInfoForHost(si *types.SharedInfo, hostID string) (string, error) {
-	proxy, ok := si.DockerProxies[hostID]
-	if !ok {
-		return StartDockerProxyForHost(si, hostID)
-	}
-
-	return proxy, nil
-}
-
-// GetDockerClientForHost ...
-// TODO: Should I cache the docker client as well???
-func GetDockerClientForHost(si *types.SharedInfo, hostID string) (*dc.Client, error) {
-	proxy, err := GetDockerProxyInfoForHost(si, hostID)
-	if err != nil {
-		return nil, err
-	}
-
-	// TODO: Fix this later
-	apiVersion := "1.24"
-	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
-	dockerClient, err := dc.NewClient(proxy, apiVersion, nil, defaultHeaders)
+	err = dockerClient.ContainerRemove(ctx, randomInstance.ExternalId, removeOpts)
 	if err != nil {
 		return nil, err
 	}
+	recordAction(ctx, "docker-remove", InstanceTarget(&randomInstance))
 
-	return dockerClient, nil
+	return &randomInstance, nil
 }
 
-// StartDockerProxyForHost ...
-func StartDockerProxyForHost(si *types.SharedInfo, hostID string) (string, error) {
-	host, err := si.Client.Host.ById(hostID)
-	if err != nil {
-		return "", err
+// StartInstance ...
+func StartInstance(ctx context.Context, si *types.SharedInfo, instance *client.Instance) error {
+	if dryRun(si, "start instance %v (%v)", instance.Name, instance.Id) {
+		return nil
 	}
-
-	if host.State != "active" {
-		return "", fmt.Errorf("Can not contact host %s in state %s", host.Hostname, host.State)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-
-	tempfile, err := ioutil.TempFile("", "docker-sock")
+	_, err := si.Client.Instance.ActionStart(instance)
 	if err != nil {
-		return "", err
-	}
-
-	if err := tempfile.Close(); err != nil {
-		return "", err
+		return err
 	}
+	recordAction(ctx, "start", InstanceTarget(instance))
+	return nil
+}
 
-	// TODO: Have an exit channel???
-	started := make(chan bool)
-	go func(tempfileName string) {
-		dockerHost := "unix://" + tempfileName
-
-		logrus.Infof("goroutine: starting proxy for dockerHost: %v", dockerHost)
-		proxy := dockerapiproxy.NewProxy(si.Client, host.Id, dockerHost)
-		if err := proxy.Listen(); err != nil {
-			logrus.Errorf("error listening for proxy: %v", err)
-			return
+// CheckInstancesRunning returns an error if any of the given instances
+// is not running
+func CheckInstancesRunning(instances []client.Instance) error {
+	for _, instance := range instances {
+		if instance.State != "running" {
+			return fmt.Errorf("instance %v is in state %v", instance.Name, instance.State)
 		}
-		started <- true
-		logrus.Debugf("docker proxy started on %v", tempfileName)
-		logrus.Fatal(proxy.Serve())
-		os.Remove(tempfileName)
-	}(tempfile.Name())
-
-	<-started
-
-	return "unix://" + tempfile.Name(), nil
-
+	}
+	return nil
 }
 
-// AddHostsUsingAPIWithoutAnyChecks ...
-func AddHostsUsingAPIWithoutAnyChecks(si *types.SharedInfo, N int) error {
-	// TODO: Fix for other clouds?
-	return AddDigitalOceanHostsUsingAPI(si, N)
-
+// GetDockerClientForHost returns a client of the docker daemon of the host
+func GetDockerClientForHost(ctx context.Context, si *types.SharedInfo, hostID string) (*dc.Client, error) {
+	if si.Docker == nil {
+		return nil, fmt.Errorf("no docker executor to reach host %v", hostID)
+	}
+	return si.Docker.Client(ctx, hostID)
 }
 
-// AddHostsUsingAPI ...
-func AddHostsUsingAPI(si *types.SharedInfo, N, expectedMaxSize int) error {
-	listOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name_prefix": "cmhost",
-			//"state_eq":    "active",  // TODO: Fix with correct states
-		},
+// CloseDockerProxies closes the connections to the docker daemons which
+// were opened
+func CloseDockerProxies(si *types.SharedInfo) {
+	if si.Docker != nil {
+		si.Docker.Close()
 	}
+}
 
-	collection, err := si.Client.Host.List(listOpts)
+// AddHostsUsingAPI returns the hosts which were created
+func AddHostsUsingAPI(ctx context.Context, si *types.SharedInfo, N, expectedMaxSize int) ([]client.Host, error) {
+	hosts, err := ListOwnedHosts(ctx, si)
 	if err != nil {
 		logrus.Errorf("error: %v", err)
-		return err
+		return nil, err
 	}
 
-	currentNumOfHosts := len(collection.Data)
+	currentNumOfHosts := 0
+	for _, host := range hosts {
+		if !IsHostGone(&host) {
+			currentNumOfHosts++
+		}
+	}
 
 	if currentNumOfHosts > expectedMaxSize {
-		return fmt.Errorf("current number of hosts(%v) is more than maximum size(%v), can't add",
+		return nil, fmt.Errorf("current number of hosts(%v) is more than maximum size(%v), can't add",
 			currentNumOfHosts, expectedMaxSize)
 	}
 
@@ -274,31 +286,43 @@ func AddHostsUsingAPI(si *types.SharedInfo, N, expectedMaxSize int) error {
 		N = newN
 	}
 
-	return AddHostsUsingAPIWithoutAnyChecks(si, N)
-}
-
-// DeleteHostsUsingAPI ...
-func DeleteHostsUsingAPI(si *types.SharedInfo, N int) error {
-	listOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name_prefix": "cmhost",
-			"state_eq":    "active",
-		},
+	added, err := AddHostsUsingAPIWithoutAnyChecks(ctx, si, N)
+	// The hosts just added are not worth deleting before they cool down
+	for _, host := range added {
+		hitTarget(si, "host", host.Id)
 	}
+	return added, err
+}
 
-	collection, err := si.Client.Host.List(listOpts)
+// DeleteHostsUsingAPI deletes hosts among the ones selected by the
+// selector, and returns them
+func DeleteHostsUsingAPI(ctx context.Context, si *types.SharedInfo, sel selector.Selector, N int) ([]client.Host, error) {
+	owned, err := ListOwnedHosts(ctx, si)
 	if err != nil {
 		logrus.Errorf("error: %v", err)
-		return err
+		return nil, err
+	}
+	// The active hosts hit by the scenarios running concurrently may be
+	// on their way out
+	claimed := si.BlastRadius.ClaimedHosts()
+	var hosts []client.Host
+	currentNumOfHosts := 0
+	for _, host := range owned {
+		if host.State != "active" {
+			continue
+		}
+		hosts = append(hosts, host)
+		if !claimed[host.Id] {
+			currentNumOfHosts++
+		}
 	}
 
-	currentNumOfHosts := len(collection.Data)
 	if !(currentNumOfHosts > 0) {
-		return fmt.Errorf("no hosts found in the cluster")
+		return nil, fmt.Errorf("no hosts found in the cluster")
 	}
 
 	if currentNumOfHosts < si.MinClusterSize {
-		return fmt.Errorf("current number of hosts(%v) is less than minimum size(%v), can't delete",
+		return nil, fmt.Errorf("current number of hosts(%v) is less than minimum size(%v), can't delete",
 			currentNumOfHosts, si.MinClusterSize)
 	}
 
@@ -311,117 +335,219 @@ func DeleteHostsUsingAPI(si *types.SharedInfo, N int) error {
 		N = newN
 	}
 
-	indicesToDelete := GetNRandomPicksFromPool(N, currentNumOfHosts)
+	hosts = spareHosts(ctx, si, restedHosts(si, SelectHosts(si, sel, hosts)))
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts available to delete")
+	}
+	if N > len(hosts) {
+		N = len(hosts)
+	}
+
+	var deleted []client.Host
+	hostNames := make([]string, len(hosts))
+	for i, host := range hosts {
+		hostNames[i] = host.Name
+	}
+
+	indicesToDelete := GetNRandomPicksFromPool(si, "delete-host", N, hostNames)
 	for index := range indicesToDelete {
-		host := &collection.Data[index]
-		_, err = si.Client.Host.ActionDeactivate(host)
-		if err != nil {
-			logrus.Errorf("couldn't deactiviate the host %v: %v", host.Name, err)
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		host := &hosts[index]
+		if err := claimHost(ctx, si, host); err != nil {
+			logrus.Infof("not deleting host %v: %v", host.Name, err)
 			continue
 		}
-		err = si.Client.Host.Delete(host)
-		if err != nil {
-			logrus.Errorf("couldn't delete the host %v: %v", host.Name, err)
+		if err := DeleteHost(ctx, si, host); err != nil {
+			logrus.Errorf("%v", err)
 			continue
 		}
+		deleted = append(deleted, *host)
+	}
+	return deleted, nil
+}
+
+// DeleteHost deactivates and deletes the given host
+func DeleteHost(ctx context.Context, si *types.SharedInfo, host *client.Host) error {
+	if dryRun(si, "deactivate and delete host %v (%v)", host.Name, host.Id) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := si.Client.Host.ActionDeactivate(host)
+	if err != nil {
+		return fmt.Errorf("couldn't deactiviate the host %v: %v", host.Name, err)
 	}
+	recordAction(ctx, "deactivate", HostTarget(host))
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("host %v deactivated but not deleted: %v", host.Name, err)
+	}
+	err = si.Client.Host.Delete(host)
+	if err != nil {
+		return fmt.Errorf("couldn't delete the host %v: %v", host.Name, err)
+	}
+	recordAction(ctx, "delete", HostTarget(host))
 	return nil
 }
 
-// GetNRandomPicksFromPool ...
-func GetNRandomPicksFromPool(N, poolSize int) map[int]int {
-	picks := make(map[int]int)
+// IsHostGone returns true if the host is being removed or is already
+// removed
+func IsHostGone(host *client.Host) bool {
+	switch host.State {
+	case "removing", "removed", "purging", "purged":
+		return true
+	}
+	return false
+}
 
-	i := 0
-	for i < N {
-		index := rand.Intn(poolSize)
-		_, ok := picks[index]
-		if !ok {
-			picks[index] = index
-			i++
+// GetInactiveHosts returns the owned hosts, which are not being removed,
+// that are not active
+func GetInactiveHosts(ctx context.Context, si *types.SharedInfo) ([]client.Host, error) {
+	hosts, err := ListOwnedHosts(ctx, si)
+	if err != nil {
+		return nil, err
+	}
+
+	var inactive []client.Host
+	for _, host := range hosts {
+		if IsHostGone(&host) {
+			continue
+		}
+		if host.State != "active" {
+			inactive = append(inactive, host)
 		}
 	}
-	return picks
+	return inactive, nil
+}
+
+// IsHostProvisioning returns true if the host is still being created
+func IsHostProvisioning(host *client.Host) bool {
+	switch host.State {
+	case "requested", "registering", "provisioning", "bootstrapping", "activating":
+		return true
+	}
+	return false
 }
 
-func getDORandomHostImageName() string {
-	images := []string{"centos-7-x64", "ubuntu-16-04-x64", "ubuntu-14-04-x64", "fedora-24-x64"}
-	return images[rand.Intn(len(images))]
+// GetFailingHosts returns the owned hosts which are not active, leaving
+// out the ones being created or removed
+func GetFailingHosts(ctx context.Context, si *types.SharedInfo) ([]client.Host, error) {
+	inactive, err := GetInactiveHosts(ctx, si)
+	if err != nil {
+		return nil, err
+	}
+
+	var failing []client.Host
+	for _, host := range inactive {
+		if !IsHostProvisioning(&host) {
+			failing = append(failing, host)
+		}
+	}
+	return failing, nil
 }
 
-func getDORandomHostSize() string {
-	//sizes := []string{"1gb", "2gb", "4gb", "8gb", "16gb", "m-16gb"}
-	sizes := []string{"1gb", "2gb", "4gb", "8gb"}
-	return sizes[rand.Intn(len(sizes))]
+// CheckHostsConverged returns an error if any of the owned hosts, which
+// are not being removed, is not active
+func CheckHostsConverged(ctx context.Context, si *types.SharedInfo) error {
+	inactive, err := GetInactiveHosts(ctx, si)
+	if err != nil {
+		return err
+	}
+	if len(inactive) > 0 {
+		return fmt.Errorf("host %v is in state %v", inactive[0].Name, inactive[0].State)
+	}
+	return nil
 }
 
-func getDORandomRegion() string {
-	locations := []string{"sfo1", "sfo2", "nyc1", "nyc2", "nyc3"}
-	return locations[rand.Intn(len(locations))]
+// GetNRandomPicksFromPool picks N distinct entries from the pool, which
+// are identified by their names, and returns their indices
+func GetNRandomPicksFromPool(si *types.SharedInfo, kind string, N int, pool []string) map[int]int {
+	picks := make(map[int]int)
+
+	for len(picks) < N && len(picks) < len(pool) {
+		var names []string
+		var indices []int
+		for index, name := range pool {
+			if _, ok := picks[index]; !ok {
+				names = append(names, name)
+				indices = append(indices, index)
+			}
+		}
+		index := indices[si.Random.Choose(kind, names, nil)]
+		picks[index] = index
+	}
+	return picks
 }
 
-// AddDigitalOceanHostsUsingAPI ...
+// AddHostsUsingAPIWithoutAnyChecks returns the hosts which were created,
+// each on one of the enabled providers picked at random
 // If N=0, random number depends on the logic
-func AddDigitalOceanHostsUsingAPI(si *types.SharedInfo, N int) error {
+func AddHostsUsingAPIWithoutAnyChecks(ctx context.Context, si *types.SharedInfo, N int) ([]client.Host, error) {
 	if N == 0 {
 		// TODO: Fix this
 		N = 1
 	}
 
+	var created []client.Host
 	for i := 0; i < N; i++ {
-		doHost := &client.Host{}
-
-		rt := RandomToken()
-		doHost.Hostname = "cmhost-" + rt
-		doHost.Name = "cmhost-" + rt
-		doHost.EngineInstallUrl = "https://releases.rancher.com/install-docker/1.12.sh"
-
-		// TODO: Make this configurable?
-		// docker URL
-		doConfig := &client.DigitaloceanConfig{
-			AccessToken:       si.DigitalOceanAccessToken,
-			Backups:           false,
-			Image:             getDORandomHostImageName(),
-			PrivateNetworking: false,
-			Region:            getDORandomRegion(),
-			Size:              getDORandomHostSize(),
-			SshUser:           "root",
-		}
-		doHost.DigitaloceanConfig = doConfig
-
-		h, err := si.Client.Host.Create(doHost)
+		if err := ctx.Err(); err != nil {
+			return created, err
+		}
+		newHost := &client.Host{}
+
+		rt := RandomToken(si)
+		newHost.Hostname = "cmhost-" + rt
+		newHost.Name = "cmhost-" + rt
+		newHost.EngineInstallUrl = "https://releases.rancher.com/install-docker/1.12.sh"
+		newHost.Labels = ownerLabels(si)
+
+		p := provider.Pick(si)
+		options := p.Configure(si, newHost)
+
+		if dryRun(si, "create host %v on %v: %v", newHost.Name, p.Name(), options) {
+			created = append(created, *newHost)
+			continue
+		}
+
+		h, err := si.Client.Host.Create(newHost)
 		if err != nil {
-			logrus.Errorf("error: %v", err)
+			logrus.Errorf("error creating host %v on %v: %v", newHost.Name, p.Name(), err)
 			continue
 		}
 		logrus.Debugf("created host: %#v", h)
+		recordAction(ctx, "create", HostTarget(h))
+		created = append(created, *h)
 	}
 
-	return nil
+	return created, nil
 }
 
 // RandomToken ...
-func RandomToken() string {
-	b := make([]byte, 8)
-	rand.Read(b)
-	return fmt.Sprintf("%x", b)
+func RandomToken(si *types.SharedInfo) string {
+	return si.Random.Token("token")
 }
 
 // SetupCluster ...
-func SetupCluster(si *types.SharedInfo) error {
+func SetupCluster(ctx context.Context, si *types.SharedInfo) error {
 	logrus.Debugf("SetupCluster")
 
-	err := AddHostsUsingAPI(si, si.StartClusterSize, si.StartClusterSize)
+	_, err := AddHostsUsingAPI(ctx, si, si.StartClusterSize, si.StartClusterSize)
 	if err != nil {
 		return err
 	}
 
-	stack, err := AddStack(si, "cmstack-long")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stack, err := AddStack(ctx, si, "cmstack-long")
 	if err != nil {
 		return err
 	}
 
-	_, err = AddService(si, stack.Id, "cmservice-long", false)
+	_, err = AddService(ctx, si, stack.Id, "cmservice-long", false)
 	if err != nil {
 		return err
 	}
@@ -430,69 +556,74 @@ func SetupCluster(si *types.SharedInfo) error {
 }
 
 // AddStack creates an empty stack and start it
-func AddStack(si *types.SharedInfo, stackName string) (*client.Stack, error) {
+func AddStack(ctx context.Context, si *types.SharedInfo, stackName string) (*client.Stack, error) {
 	logrus.Debugf("AddStack: %v", stackName)
-	listOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name_eq": stackName,
-		},
-	}
-
-	collection, err := si.Client.Stack.List(listOpts)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(collection.Data) > 0 {
-		return &collection.Data[0], nil
+	existing, err := FindOwnedStack(ctx, si, stackName)
+	if err != nil || existing != nil {
+		return existing, err
 	}
 
 	stack := client.Stack{
 		Name:          stackName,
+		ExternalId:    ownerExternalID(si),
 		StartOnCreate: true,
 	}
-	return si.Client.Stack.Create(&stack)
+	if dryRun(si, "create stack %v", stackName) {
+		return &stack, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	created, err := si.Client.Stack.Create(&stack)
+	if err != nil {
+		return nil, err
+	}
+	recordAction(ctx, "create", types.Target{Kind: "stack", ID: created.Id, Name: created.Name})
+	return created, nil
 }
 
-// DeleteStack creates an empty stack and start it
-func DeleteStack(si *types.SharedInfo, stackName string) error {
+// DeleteStack deletes the owned stack with the given name
+func DeleteStack(ctx context.Context, si *types.SharedInfo, stackName string) error {
 	logrus.Debugf("DeleteStack: %v", stackName)
-	listOpts := &client.ListOpts{
-		Filters: map[string]interface{}{
-			"name_eq": stackName,
-		},
-	}
-
-	collection, err := si.Client.Stack.List(listOpts)
+	stack, err := FindOwnedStack(ctx, si, stackName)
 	if err != nil {
 		return err
 	}
 
-	if !(len(collection.Data) > 0) {
+	if stack == nil {
 		return fmt.Errorf("stack doesn't exist with given name: %v", stackName)
 	}
-
-	stack := collection.Data[0]
-	err = si.Client.Stack.Delete(&stack)
+	if dryRun(si, "delete stack %v (%v)", stack.Name, stack.Id) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err = si.Client.Stack.Delete(stack)
 	if err != nil {
 		return err
 	}
+	recordAction(ctx, "delete", types.Target{Kind: "stack", ID: stack.Id, Name: stack.Name})
 
 	return nil
 }
 
 // AddService ...
-func AddService(si *types.SharedInfo, stackID, serviceName string, enableHealthCheck bool) (*client.Service, error) {
+func AddService(ctx context.Context, si *types.SharedInfo, stackID, serviceName string, enableHealthCheck bool) (*client.Service, error) {
 	logrus.Debugf("AddService: %v", serviceName)
 
-	service, err := getServiceByName(si, serviceName)
+	service, err := getServiceByName(ctx, si, serviceName)
 	if err == nil {
 		return service, nil
 	}
 
+	// The containers of the service are eligible even with opt-in
+	labels := ownerLabels(si)
+	labels["io.rancher.container.pull_image"] = "always"
 	service = &client.Service{
 		StackId:       stackID,
 		Name:          serviceName,
+		ExternalId:    ownerExternalID(si),
 		Scale:         1,
 		StartOnCreate: true,
 		LaunchConfig: &client.LaunchConfig{
@@ -501,9 +632,7 @@ func AddService(si *types.SharedInfo, stackID, serviceName string, enableHealthC
 			StartOnCreate:         true,
 			InstanceTriggeredStop: "stop",
 			Vcpu: 1,
-			Labels: map[string]interface{}{
-				"io.rancher.container.pull_image": "always",
-			},
+			Labels:                labels,
 		},
 	}
 
@@ -521,10 +650,24 @@ func AddService(si *types.SharedInfo, stackID, serviceName string, enableHealthC
 		}
 	}
 
-	return si.Client.Service.Create(service)
+	if dryRun(si, "create service %v in stack %v", serviceName, stackID) {
+		return service, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	service, err = si.Client.Service.Create(service)
+	if err != nil {
+		return nil, err
+	}
+	recordAction(ctx, "create", ServiceTarget(service))
+	return service, nil
 }
 
-func getServiceByName(si *types.SharedInfo, serviceName string) (*client.Service, error) {
+func getServiceByName(ctx context.Context, si *types.SharedInfo, serviceName string) (*client.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	listOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
 			"name_eq": serviceName,
@@ -536,53 +679,70 @@ func getServiceByName(si *types.SharedInfo, serviceName string) (*client.Service
 		return nil, err
 	}
 
-	if !(len(collection.Data) > 0) {
-		return nil, fmt.Errorf("service doesn't exist with given name: %v", serviceName)
+	for _, service := range collection.Data {
+		if IsOwnedService(si, &service) && !isGone(service.State) {
+			return &service, nil
+		}
 	}
 
-	service := collection.Data[0]
-
-	return &service, nil
+	return nil, fmt.Errorf("service doesn't exist with given name: %v", serviceName)
 }
 
 // DeleteServiceByName ...
-func DeleteServiceByName(si *types.SharedInfo, serviceName string) error {
+func DeleteServiceByName(ctx context.Context, si *types.SharedInfo, serviceName string) error {
 	logrus.Debugf("DeleteService: %v", serviceName)
 
-	service, err := getServiceByName(si, serviceName)
+	service, err := getServiceByName(ctx, si, serviceName)
 	if err != nil {
 		return err
 	}
 
+	if dryRun(si, "delete service %v (%v)", service.Name, service.Id) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err = si.Client.Service.Delete(service)
 	if err != nil {
 		return err
 	}
+	recordAction(ctx, "delete", ServiceTarget(service))
 	return nil
 }
 
 // DeleteServiceByID ...
-func DeleteServiceByID(si *types.SharedInfo, serviceID string) error {
+func DeleteServiceByID(ctx context.Context, si *types.SharedInfo, serviceID string) error {
 	logrus.Debugf("DeleteService: %v", serviceID)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	service, err := si.Client.Service.ById(serviceID)
 	if err != nil {
 		return err
 	}
 
+	if dryRun(si, "delete service %v (%v)", service.Name, service.Id) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err = si.Client.Service.Delete(service)
 	if err != nil {
 		return err
 	}
+	recordAction(ctx, "delete", ServiceTarget(service))
 
 	return nil
 }
 
 // ChangeServiceScale ...
-func ChangeServiceScale(si *types.SharedInfo, serviceName string, newScale int) error {
+func ChangeServiceScale(ctx context.Context, si *types.SharedInfo, serviceName string, newScale int) error {
 	logrus.Debugf("ChangeServiceScale of %v to %v", serviceName, newScale)
 
-	service, err := getServiceByName(si, serviceName)
+	service, err := getServiceByName(ctx, si, serviceName)
 	if err != nil {
 		return err
 	}
@@ -590,16 +750,29 @@ func ChangeServiceScale(si *types.SharedInfo, serviceName string, newScale int)
 	updates := map[string]interface{}{
 		"scale": newScale,
 	}
+	if dryRun(si, "change scale of service %v to %v", serviceName, newScale) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	_, err = si.Client.Service.Update(service, updates)
 	if err != nil {
 		return err
 	}
+	recordAction(ctx, "scale", ServiceTarget(service))
 
 	return nil
 }
 
 // AddAPIAccountKey ...
-func AddAPIAccountKey(si *types.SharedInfo) error {
+func AddAPIAccountKey(ctx context.Context, si *types.SharedInfo) error {
+	if dryRun(si, "create API key") {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	ak, err := si.Client.ApiKey.Create(&client.ApiKey{
 		Name: "juliet",
 	})
@@ -612,7 +785,7 @@ func AddAPIAccountKey(si *types.SharedInfo) error {
 }
 
 // EnableSystemRole ...
-func EnableSystemRole(si *types.SharedInfo) error {
+func EnableSystemRole(ctx context.Context, si *types.SharedInfo) error {
 	return nil
 }
 
@@ -621,7 +794,10 @@ func EnableSystemRole(si *types.SharedInfo) error {
 func AddLongRunningStack() {
 }
 
-func getProjectList(si *types.SharedInfo) error {
+func getProjectList(ctx context.Context, si *types.SharedInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	listOpts := &client.ListOpts{Filters: map[string]interface{}{}}
 	collection, err := si.RawClient.Project.List(listOpts)
 	if err != nil {
@@ -632,10 +808,18 @@ func getProjectList(si *types.SharedInfo) error {
 	return nil
 }
 
-// GetSelfProjectUUID ...
-func GetSelfProjectUUID() (string, error) {
-	mc, err := metadata.NewClientAndWait("http://rancher-metadata/2016-07-29")
-	if err != nil {
+// metadataURL is the URL of the Rancher metadata service
+const metadataURL = "http://rancher-metadata/2016-07-29"
+
+// metadataMaxWait is how long the metadata service is waited for
+const metadataMaxWait = 20 * time.Second
+
+// GetSelfProjectUUID returns the UUID of the project the chaos monkey
+// runs in, waiting for the metadata service to answer unless the context
+// is cancelled meanwhile
+func GetSelfProjectUUID(ctx context.Context) (string, error) {
+	mc := metadata.NewClient(metadataURL)
+	if err := waitForMetadata(ctx, mc); err != nil {
 		logrus.Errorf("error creating metadata client: %v", err)
 		return "", err
 	}
@@ -649,13 +833,36 @@ func GetSelfProjectUUID() (string, error) {
 	return self.EnvironmentUUID, nil
 }
 
+func waitForMetadata(ctx context.Context, mc metadata.Client) error {
+	wait := 500 * time.Millisecond
+	deadline := time.Now().Add(metadataMaxWait)
+	for {
+		_, err := mc.GetVersion()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("metadata service not reachable: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
 // GetSelfProjectID ...
-func GetSelfProjectID(rawClient *client.RancherClient) (string, error) {
-	selfProjectUUID, err := GetSelfProjectUUID()
+func GetSelfProjectID(ctx context.Context, rawClient *rancher.Client) (string, error) {
+	selfProjectUUID, err := GetSelfProjectUUID(ctx)
 	if err != nil {
 		return "", err
 	}
 	logrus.Debugf("got selfProjectUUID from metadata: %v", selfProjectUUID)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 
 	listOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
@@ -684,35 +891,80 @@ func GetSelfProjectID(rawClient *client.RancherClient) (string, error) {
 	return collection.Data[0].Id, nil
 }
 
-// GetChaosMonkeyProjectID ...
-func GetChaosMonkeyProjectID(rawClient *client.RancherClient) (string, error) {
-	defaultChaosMonkeyProjectName := "chaosmonkey"
-
+// FindChaosMonkeyProject returns the project owned by this chaos monkey
+// instance, in any state but removed, or nil if there is none
+func FindChaosMonkeyProject(ctx context.Context, si *types.SharedInfo) (*client.Project, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	listOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
-			"name_eq":  defaultChaosMonkeyProjectName,
-			"state_eq": "active",
+			"name_eq": ChaosMonkeyProjectName(si),
 		},
 	}
 
-	collection, err := rawClient.Project.List(listOpts)
+	collection, err := si.RawClient.Project.List(listOpts)
 	if err != nil {
 		logrus.Errorf("error getting self project: %v", err)
-		return "", err
+		return nil, err
 	}
-	logrus.Infof("collection: %+v", collection)
+	logrus.Debugf("collection: %+v", collection)
 
-	l := len(collection.Data)
+	var projects []client.Project
+	for collection != nil {
+		projects = append(projects, collection.Data...)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collection, err = collection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var owned []client.Project
+	for _, p := range projects {
+		// Projects left over by an interrupted teardown are still found
+		if p.State == "removed" || p.State == "purged" {
+			continue
+		}
+		if IsOwnedProject(si, &p) {
+			owned = append(owned, p)
+		} else {
+			logrus.Debugf("project %v (%v) isn't owned by chaos monkey instance %v, ignoring it",
+				p.Name, p.Id, si.InstanceID)
+		}
+	}
+
+	l := len(owned)
 	if l > 1 {
 		e := fmt.Errorf("expecting only one chaosmonkey environment but found: %v", l)
 		logrus.Errorf("%v", e)
-		return "", e
+		return nil, e
 	} else if l == 1 {
-		return collection.Data[0].Id, nil
+		return &owned[0], nil
+	}
+	return nil, nil
+}
+
+// GetChaosMonkeyProjectID returns the ID of the chaosmonkey project,
+// adopting the one created before the projects were marked, or creating
+// it if needed
+func GetChaosMonkeyProjectID(ctx context.Context, si *types.SharedInfo) (string, error) {
+	p, err := FindOrAdoptChaosMonkeyProject(ctx, si)
+	if err != nil {
+		return "", err
+	}
+	if p != nil && p.State != "active" {
+		return "", fmt.Errorf("project %v (%v) is %v, tear it down or activate it first",
+			p.Name, p.Id, p.State)
+	}
+	if p != nil {
+		return p.Id, nil
 	}
 
 	// TODO: support for custom catalog
-	p, err := CreateProject(rawClient, defaultChaosMonkeyProjectName, "Cattle", "library")
+	p, err = CreateProject(ctx, si, ChaosMonkeyProjectName(si), "Cattle", "library")
 	if err != nil {
 		return "", err
 	}
@@ -720,11 +972,179 @@ func GetChaosMonkeyProjectID(rawClient *client.RancherClient) (string, error) {
 	return p.Id, nil
 }
 
+// FindOrAdoptChaosMonkeyProject returns the project owned by this chaos
+// monkey instance, adopting the one created before the projects were
+// marked, or nil if there is none
+func FindOrAdoptChaosMonkeyProject(ctx context.Context, si *types.SharedInfo) (*client.Project, error) {
+	p, err := FindChaosMonkeyProject(ctx, si)
+	if err != nil || p != nil {
+		return p, err
+	}
+	return adoptChaosMonkeyProject(ctx, si)
+}
+
+// adoptChaosMonkeyProject marks as owned the project with the name of the
+// chaosmonkey project which isn't marked, as created by an older chaos
+// monkey, and returns it, or nil if there is none. A project of the name
+// owned by another instance is an error, rather than creating another one.
+func adoptChaosMonkeyProject(ctx context.Context, si *types.SharedInfo) (*client.Project, error) {
+	name := ChaosMonkeyProjectName(si)
+	collection, err := si.RawClient.Project.List(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"name_eq": name,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var unmarked []client.Project
+	for collection != nil {
+		for _, p := range collection.Data {
+			if p.State == "removed" || p.State == "purged" {
+				continue
+			}
+			if owner := ProjectOwner(&p); owner != "" {
+				return nil, fmt.Errorf("project %v (%v) is owned by chaos monkey instance %v, use another instance ID",
+					p.Name, p.Id, owner)
+			}
+			unmarked = append(unmarked, p)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collection, err = collection.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unmarked) == 0 {
+		return nil, nil
+	} else if len(unmarked) > 1 {
+		return nil, fmt.Errorf("expecting only one %v project to adopt but found: %v", name, len(unmarked))
+	}
+
+	p := &unmarked[0]
+	logrus.Infof("adopting project %v (%v) created by an older chaos monkey", p.Name, p.Id)
+	if dryRun(si, "mark project %v (%v) as owned", p.Name, p.Id) {
+		return p, nil
+	}
+	p, err = si.RawClient.Project.Update(p, map[string]interface{}{
+		"description": ownerDescription(si),
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordAction(ctx, "adopt", ProjectTarget(p))
+	return p, nil
+}
+
+// AdoptLegacyResources marks as owned the cmhost hosts and the
+// cmstack-long stack and its services of the project which aren't marked,
+// as created by an older chaos monkey. Resources owned by another instance
+// are left alone.
+func AdoptLegacyResources(ctx context.Context, si *types.SharedInfo) error {
+	hosts, err := ListHosts(ctx, si, &client.ListOpts{})
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if !strings.HasPrefix(host.Name, "cmhost-") || HostOwner(&host) != "" || isGone(host.State) {
+			continue
+		}
+		logrus.Infof("adopting host %v (%v) created by an older chaos monkey", host.Name, host.Id)
+		if dryRun(si, "mark host %v (%v) as owned", host.Name, host.Id) {
+			continue
+		}
+		labels := map[string]interface{}{}
+		for k, v := range host.Labels {
+			labels[k] = v
+		}
+		for k, v := range ownerLabels(si) {
+			labels[k] = v
+		}
+		adopted, err := si.Client.Host.Update(&host, map[string]interface{}{
+			"labels": labels,
+		})
+		if err != nil {
+			return err
+		}
+		recordAction(ctx, "adopt", HostTarget(adopted))
+	}
+
+	stacks, err := listStacks(ctx, si, &client.ListOpts{
+		Filters: map[string]interface{}{
+			"name_eq": "cmstack-long",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, stack := range stacks {
+		if StackOwner(&stack) != "" || isGone(stack.State) {
+			continue
+		}
+		if err := adoptStack(ctx, si, &stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptStack marks as owned the stack and its services which aren't
+// marked
+func adoptStack(ctx context.Context, si *types.SharedInfo, stack *client.Stack) error {
+	logrus.Infof("adopting stack %v (%v) created by an older chaos monkey", stack.Name, stack.Id)
+	if !dryRun(si, "mark stack %v (%v) as owned", stack.Name, stack.Id) {
+		adopted, err := si.Client.Stack.Update(stack, map[string]interface{}{
+			"externalId": ownerExternalID(si),
+		})
+		if err != nil {
+			return err
+		}
+		recordAction(ctx, "adopt", types.Target{Kind: "stack", ID: adopted.Id, Name: adopted.Name})
+	}
+
+	services, err := ListServices(ctx, si, &client.ListOpts{
+		Filters: map[string]interface{}{
+			"stackId": stack.Id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if ownerOfExternalID(service.ExternalId) != "" || isGone(service.State) {
+			continue
+		}
+		logrus.Infof("adopting service %v (%v) created by an older chaos monkey", service.Name, service.Id)
+		if dryRun(si, "mark service %v (%v) as owned", service.Name, service.Id) {
+			continue
+		}
+		adopted, err := si.Client.Service.Update(&service, map[string]interface{}{
+			"externalId": ownerExternalID(si),
+		})
+		if err != nil {
+			return err
+		}
+		recordAction(ctx, "adopt", ServiceTarget(adopted))
+	}
+	return nil
+}
+
+// DryRunProjectID is the ID of the project CreateProject returns in
+// dry-run mode, which doesn't exist
+const DryRunProjectID = "dry-run"
+
 // CreateProject ...
 // TODO: Probably needs work for custom template
-func CreateProject(rawClient *client.RancherClient, projectName, projectTemplateName, catalogName string) (*client.Project, error) {
+func CreateProject(ctx context.Context, si *types.SharedInfo, projectName, projectTemplateName, catalogName string) (*client.Project, error) {
 	logrus.Debugf("CreateProject: projectName=%v projectTemplateName=%v catalogName=%v",
 		projectName, projectTemplateName, catalogName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	listOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
@@ -733,7 +1153,7 @@ func CreateProject(rawClient *client.RancherClient, projectName, projectTemplate
 		},
 	}
 
-	collection, err := rawClient.ProjectTemplate.List(listOpts)
+	collection, err := si.RawClient.ProjectTemplate.List(listOpts)
 	if err != nil {
 		logrus.Errorf("error getting self project: %v", err)
 		return nil, err
@@ -751,23 +1171,37 @@ func CreateProject(rawClient *client.RancherClient, projectName, projectTemplate
 	// TODO: Needs work for authentication
 	p := &client.Project{
 		Name:              projectName,
+		Description:       ownerDescription(si),
 		ProjectTemplateId: template.Id,
 		AllowSystemRole:   true,
 	}
 
-	p, err = rawClient.Project.Create(p)
+	if dryRun(si, "create project %v from template %v", projectName, template.Name) {
+		p.Id = DryRunProjectID
+		p.State = "active"
+		return p, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err = si.RawClient.Project.Create(p)
 	if err != nil {
 		return nil, err
 	}
+	recordAction(ctx, "create", ProjectTarget(p))
 
 	logrus.Debugf("created project: %v", p)
 	return p, nil
 }
 
-// DeleteProject ...
-// TODO: Probably needs work for custom template
-func DeleteProject(rawClient *client.RancherClient, projectName string) error {
+// DeleteProject deactivates, deletes and purges the project, waiting for
+// each step
+func DeleteProject(ctx context.Context, si *types.SharedInfo, projectName string) error {
 	logrus.Debugf("DeleteProject: projectName=%v", projectName)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	listOpts := &client.ListOpts{
 		Filters: map[string]interface{}{
@@ -776,7 +1210,7 @@ func DeleteProject(rawClient *client.RancherClient, projectName string) error {
 		},
 	}
 
-	collection, err := rawClient.Project.List(listOpts)
+	collection, err := si.RawClient.Project.List(listOpts)
 	if err != nil {
 		logrus.Errorf("error getting self project: %v", err)
 		return err
@@ -789,18 +1223,9 @@ func DeleteProject(rawClient *client.RancherClient, projectName string) error {
 		return fmt.Errorf("expecting only one project with name %v but found: %v", projectName, l)
 	}
 
-	p := &collection.Data[0]
-
-	if p.State != "inactive" {
-		_, err = rawClient.Project.ActionDeactivate(p)
-		if err != nil {
-			return err
-		}
-	}
-
-	//TODO: Not working
-	err = rawClient.Project.Delete(p)
-	if err != nil {
+	// The project has to be inactive before it can be deleted, and
+	// removed before it can be purged
+	if err := teardownProject(ctx, si, &collection.Data[0]); err != nil {
 		return err
 	}
 
@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/leodotcloud/chaos-monkey/rancher/fake"
+	"github.com/leodotcloud/chaos-monkey/random"
+	"github.com/leodotcloud/chaos-monkey/types"
+	"github.com/rancher/go-rancher/v2"
+)
+
+// serve starts a fake Rancher server and returns the shared info reaching
+// its account
+func serve(t *testing.T) (*fake.Server, *types.SharedInfo) {
+	s := fake.NewServer(fake.New())
+	raw, err := GetRawClient(context.Background(), s.URL, "", "")
+	if err != nil {
+		s.Close()
+		t.Fatalf("error connecting to the fake server: %v", err)
+	}
+	return s, &types.SharedInfo{
+		RawClient:  raw,
+		InstanceID: DefaultInstanceID,
+		Campaign:   "test",
+		Random:     random.New(1),
+	}
+}
+
+// seed adds a resource to the fake server and returns its ID
+func seed(t *testing.T, s *fake.Server, project, kind string, v interface{}) string {
+	res, err := s.Rancher.Seed(project, kind, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res["id"].(string)
+}
+
+// useProject seeds a project owned by the chaos monkey and points the
+// client of the shared info to it
+func useProject(t *testing.T, s *fake.Server, si *types.SharedInfo) string {
+	projectID := seed(t, s, "", fake.ProjectKind, client.Project{
+		Name:        ChaosMonkeyProjectName(si),
+		Description: ownerDescription(si),
+		State:       "active",
+	})
+	c, err := GetClientForProject(context.Background(), s.URL, projectID, "", "")
+	if err != nil {
+		t.Fatalf("error connecting to project %v: %v", projectID, err)
+	}
+	si.Client = c
+	return projectID
+}
+
+func ownedHost(si *types.SharedInfo, name, state string) client.Host {
+	return client.Host{
+		Name:   name,
+		State:  state,
+		Labels: ownerLabels(si),
+	}
+}
+
+func TestListOwnedHostsPages(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+
+	owned := fake.DefaultLimit*2 + 10
+	for i := 0; i < owned; i++ {
+		seed(t, s, projectID, fake.HostKind, ownedHost(si, fmt.Sprintf("cmhost-%v", i), "active"))
+		if i%50 == 0 {
+			seed(t, s, projectID, fake.HostKind, client.Host{Name: fmt.Sprintf("other-%v", i), State: "active"})
+		}
+	}
+
+	hosts, err := ListOwnedHosts(context.Background(), si)
+	if err != nil {
+		t.Fatalf("ListOwnedHosts failed: %v", err)
+	}
+	if len(hosts) != owned {
+		t.Errorf("listed %v owned hosts, expecting %v", len(hosts), owned)
+	}
+	for _, host := range hosts {
+		if !strings.HasPrefix(host.Name, "cmhost-") {
+			t.Errorf("listed host %v, which isn't owned", host.Name)
+		}
+	}
+}
+
+func TestListOwnedHostsCancelled(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+	for i := 0; i < fake.DefaultLimit+1; i++ {
+		seed(t, s, projectID, fake.HostKind, ownedHost(si, fmt.Sprintf("cmhost-%v", i), "active"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ListOwnedHosts(ctx, si); err != context.Canceled {
+		t.Errorf("ListOwnedHosts returned %v, expecting %v", err, context.Canceled)
+	}
+}
+
+func TestGetFailingHosts(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	projectID := useProject(t, s, si)
+
+	states := map[string]bool{
+		"active":       false,
+		"inactive":     true,
+		"reconnecting": true,
+		"disconnected": true,
+		"provisioning": false,
+		"registering":  false,
+		"removed":      false,
+	}
+	for state := range states {
+		seed(t, s, projectID, fake.HostKind, ownedHost(si, "cmhost-"+state, state))
+	}
+	seed(t, s, projectID, fake.HostKind, client.Host{Name: "other-inactive", State: "inactive"})
+
+	failing, err := GetFailingHosts(context.Background(), si)
+	if err != nil {
+		t.Fatalf("GetFailingHosts failed: %v", err)
+	}
+	got := map[string]bool{}
+	for _, host := range failing {
+		got[host.State] = true
+	}
+	for state, want := range states {
+		if got[state] != want {
+			t.Errorf("host %v counted as failing: %v, expecting %v", state, got[state], want)
+		}
+	}
+	if len(failing) != 3 {
+		t.Errorf("found %v failing hosts, expecting 3", len(failing))
+	}
+
+	if err := CheckHostsConverged(context.Background(), si); err == nil {
+		t.Errorf("CheckHostsConverged did not fail with hosts still provisioning")
+	}
+}
+
+func TestGetChaosMonkeyProjectID(t *testing.T) {
+	owned := ownerDescription(&types.SharedInfo{InstanceID: DefaultInstanceID, Campaign: "older"})
+	foreign := ownerDescription(&types.SharedInfo{InstanceID: "other", Campaign: "older"})
+
+	tests := []struct {
+		name     string
+		projects []client.Project
+		dryRun   bool
+		// want is the index of the project expected, -1 for a new one
+		want    int
+		adopted bool
+		err     string
+	}{
+		{name: "creates", want: -1},
+		{
+			name:     "finds the owned project",
+			projects: []client.Project{{State: "active", Description: owned}},
+			want:     0,
+		},
+		{
+			name:     "ignores the removed projects",
+			projects: []client.Project{{State: "removed", Description: owned}, {State: "purged", Description: owned}},
+			want:     -1,
+		},
+		{
+			name:     "adopts an unmarked project",
+			projects: []client.Project{{State: "active"}},
+			want:     0,
+			adopted:  true,
+		},
+		{
+			name:     "doesn't adopt in dry-run",
+			projects: []client.Project{{State: "active"}},
+			dryRun:   true,
+			want:     0,
+		},
+		{
+			name:     "prefers the owned project",
+			projects: []client.Project{{State: "active"}, {State: "active", Description: owned}},
+			want:     1,
+		},
+		{
+			name:     "stops on a project of another instance",
+			projects: []client.Project{{State: "active", Description: foreign}},
+			err:      "owned by chaos monkey instance other",
+		},
+		{
+			name:     "stops on an inactive project",
+			projects: []client.Project{{State: "inactive", Description: owned}},
+			err:      "is inactive",
+		},
+		{
+			name:     "stops on several unmarked projects",
+			projects: []client.Project{{State: "active"}, {State: "active"}},
+			err:      "only one",
+		},
+	}
+
+	for _, test := range tests {
+		s, si := serve(t)
+		si.DryRun = test.dryRun
+		seed(t, s, "", fake.ProjectTemplateKind, client.ProjectTemplate{
+			Name:       "Cattle",
+			ExternalId: "catalog://library:project-templates:cattle:0",
+		})
+		var ids []string
+		for _, p := range test.projects {
+			p.Name = ChaosMonkeyProjectName(si)
+			ids = append(ids, seed(t, s, "", fake.ProjectKind, p))
+		}
+
+		id, err := GetChaosMonkeyProjectID(context.Background(), si)
+		s.Close()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: returned %v, expecting an error about %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed: %v", test.name, err)
+			continue
+		}
+
+		if test.want >= 0 {
+			if id != ids[test.want] {
+				t.Errorf("%v: returned project %v, expecting %v", test.name, id, ids[test.want])
+			}
+		} else {
+			for _, existing := range ids {
+				if id == existing {
+					t.Errorf("%v: returned the existing project %v, expecting a new one", test.name, id)
+				}
+			}
+		}
+
+		if id == DryRunProjectID {
+			continue
+		}
+		p, err := s.Rancher.Get("", fake.ProjectKind, id)
+		if err != nil {
+			t.Errorf("%v: project %v not found: %v", test.name, id, err)
+			continue
+		}
+		marked := p["description"] == ownerDescription(si)
+		if want := test.want < 0 || test.adopted; marked != want {
+			t.Errorf("%v: project %v marked as owned by this run: %v, expecting %v", test.name, id, marked, want)
+		}
+	}
+}
+
+func TestFindChaosMonkeyProjectPages(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+
+	owned := ownerDescription(si)
+	for i := 0; i < fake.DefaultLimit+5; i++ {
+		seed(t, s, "", fake.ProjectKind, client.Project{
+			Name:        ChaosMonkeyProjectName(si),
+			Description: owned,
+			State:       "removed",
+		})
+	}
+	want := seed(t, s, "", fake.ProjectKind, client.Project{
+		Name:        ChaosMonkeyProjectName(si),
+		Description: owned,
+		State:       "active",
+	})
+
+	p, err := FindChaosMonkeyProject(context.Background(), si)
+	if err != nil {
+		t.Fatalf("FindChaosMonkeyProject failed: %v", err)
+	}
+	if p == nil || p.Id != want {
+		t.Errorf("found %v, expecting project %v on the second page", p, want)
+	}
+}
+
+func TestCreateProjectDryRun(t *testing.T) {
+	s, si := serve(t)
+	defer s.Close()
+	si.DryRun = true
+	seed(t, s, "", fake.ProjectTemplateKind, client.ProjectTemplate{
+		Name:       "Cattle",
+		ExternalId: "catalog://library:project-templates:cattle:0",
+	})
+
+	p, err := CreateProject(context.Background(), si, "chaosmonkey", "Cattle", "library")
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if p.Id != DryRunProjectID {
+		t.Errorf("dry-run created project %v, expecting %v", p.Id, DryRunProjectID)
+	}
+	projects, _ := s.Rancher.List("", fake.ProjectKind, nil)
+	if len(projects) != 0 {
+		t.Errorf("dry-run created %v projects", len(projects))
+	}
+}
+
+func TestAdoptLegacyResources(t *testing.T) {
+	other := &types.SharedInfo{InstanceID: "other", Campaign: "older"}
+
+	for _, dryRun := range []bool{false, true} {
+		s, si := serve(t)
+		si.DryRun = dryRun
+		projectID := useProject(t, s, si)
+
+		legacyHost := seed(t, s, projectID, fake.HostKind, client.Host{
+			Name:   "cmhost-a",
+			State:  "active",
+			Labels: map[string]interface{}{"zone": "a"},
+		})
+		foreignHost := seed(t, s, projectID, fake.HostKind, ownedHost(other, "cmhost-b", "active"))
+		userHost := seed(t, s, projectID, fake.HostKind, client.Host{Name: "worker", State: "active"})
+		legacyStack := seed(t, s, projectID, fake.StackKind, client.Stack{Name: "cmstack-long", State: "active"})
+		legacyService := seed(t, s, projectID, fake.ServiceKind, client.Service{
+			Name:    "svc",
+			State:   "active",
+			StackId: legacyStack,
+		})
+		foreignStack := seed(t, s, projectID, fake.StackKind, client.Stack{
+			Name:       "cmstack-long",
+			State:      "active",
+			ExternalId: ownerExternalID(other),
+		})
+
+		if err := AdoptLegacyResources(context.Background(), si); err != nil {
+			s.Close()
+			t.Fatalf("dry-run %v: AdoptLegacyResources failed: %v", dryRun, err)
+		}
+
+		adopted := !dryRun
+		for _, id := range []string{legacyHost, foreignHost, userHost} {
+			res, err := s.Rancher.Get(projectID, fake.HostKind, id)
+			if err != nil {
+				t.Fatalf("dry-run %v: host %v not found: %v", dryRun, id, err)
+			}
+			labels, _ := res["labels"].(map[string]interface{})
+			owned := labels[InstanceLabel] == si.InstanceID
+			if want := adopted && id == legacyHost; owned != want {
+				t.Errorf("dry-run %v: host %v owned: %v, expecting %v", dryRun, res["name"], owned, want)
+			}
+			if id == legacyHost && labels["zone"] != "a" {
+				t.Errorf("dry-run %v: the labels of host %v were not kept: %v", dryRun, res["name"], labels)
+			}
+		}
+
+		for _, r := range []struct {
+			kind, id string
+			want     bool
+		}{
+			{fake.StackKind, legacyStack, adopted},
+			{fake.ServiceKind, legacyService, adopted},
+			{fake.StackKind, foreignStack, false},
+		} {
+			res, err := s.Rancher.Get(projectID, r.kind, r.id)
+			if err != nil {
+				t.Fatalf("dry-run %v: %v %v not found: %v", dryRun, r.kind, r.id, err)
+			}
+			if owned := res["externalId"] == ownerExternalID(si); owned != r.want {
+				t.Errorf("dry-run %v: %v %v owned: %v, expecting %v", dryRun, r.kind, r.id, owned, r.want)
+			}
+		}
+		s.Close()
+	}
+}